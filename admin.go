@@ -0,0 +1,241 @@
+//
+// Copyright 2016 Marios Andreopoulos
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/andmarios/sensor_exporter/sensor"
+)
+
+var (
+	adminToken   = flag.String("admin-token", "", "bearer token for the admin API; the API is disabled if empty")
+	adminPersist = flag.Bool("admin-persist", false, "write changes made through the admin API back to the config file")
+)
+
+// scraperConfig is how a scraper is presented and set through the admin
+// API. It has the same fields as a sensor_name,interval,opts argument.
+type scraperConfig struct {
+	ID       int    `json:"id,omitempty"`
+	Type     string `json:"type"`
+	Instance string `json:"instance,omitempty"`
+	Interval string `json:"interval,omitempty"`
+	Opts     string `json:"opts"`
+	Required bool   `json:"required,omitempty"`
+	Ready    bool   `json:"ready"`
+}
+
+func configOf(s *Scraper) scraperConfig {
+	return scraperConfig{ID: s.ID, Type: s.Type, Instance: s.Instance, Interval: s.Interval.String(), Opts: s.Opts,
+		Required: s.Required, Ready: s.isReady()}
+}
+
+// adminHandler serves the admin API:
+//
+//	GET    /admin/scrapers       list scrapers
+//	POST   /admin/scrapers       add a scraper
+//	GET    /admin/scrapers/ID    show a scraper
+//	PUT    /admin/scrapers/ID    replace a scraper
+//	DELETE /admin/scrapers/ID    remove a scraper
+func adminHandler(w http.ResponseWriter, r *http.Request) {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") ||
+		subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(*adminToken)) != 1 {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	idString := strings.Trim(strings.TrimPrefix(r.URL.Path, "/admin/scrapers"), "/")
+	if idString == "" {
+		switch r.Method {
+		case http.MethodGet:
+			scrapersMutex.RLock()
+			list := []scraperConfig{}
+			for _, s := range scrapers {
+				list = append(list, configOf(s))
+			}
+			scrapersMutex.RUnlock()
+			writeJSON(w, http.StatusOK, list)
+		case http.MethodPost:
+			adminAdd(w, r)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	id, err := strconv.Atoi(idString)
+	if err != nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		scrapersMutex.RLock()
+		defer scrapersMutex.RUnlock()
+		if i := scraperIndex(id); i >= 0 {
+			writeJSON(w, http.StatusOK, configOf(scrapers[i]))
+			return
+		}
+		http.Error(w, "not found", http.StatusNotFound)
+	case http.MethodPut:
+		adminUpdate(w, r, id)
+	case http.MethodDelete:
+		adminDelete(w, id)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func adminAdd(w http.ResponseWriter, r *http.Request) {
+	scraper, err := scraperFromRequest(r, nil)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	scraper.Persist = true
+	addScraper(scraper)
+	startSensor(scraper)
+	log.Printf("Admin API added scraper %d for sensor %s\n", scraper.ID, scraper.Type)
+	persistConfig()
+	writeJSON(w, http.StatusCreated, configOf(scraper))
+}
+
+func adminUpdate(w http.ResponseWriter, r *http.Request, id int) {
+	scrapersMutex.RLock()
+	i := scraperIndex(id)
+	var old *Scraper
+	if i >= 0 {
+		old = scrapers[i]
+	}
+	scrapersMutex.RUnlock()
+	if old == nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	// Create the new scraper before touching the old one, so a bad request
+	// leaves things as they were. If the sensor type stays the same, the
+	// scraper keeps its instance label.
+	scraper, err := scraperFromRequest(r, old)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	scrapersMutex.Lock()
+	i = scraperIndex(id)
+	if i < 0 {
+		scrapersMutex.Unlock()
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	stopSensor(scrapers[i])
+	scraper.ID = id
+	// Scrapers set in the command line stay out of the config file, or
+	// they would run twice after a restart.
+	scraper.Persist = scrapers[i].Persist
+	scrapers[i] = scraper
+	updateSupportTexts()
+	scrapersMutex.Unlock()
+
+	startSensor(scraper)
+	log.Printf("Admin API updated scraper %d for sensor %s\n", scraper.ID, scraper.Type)
+	persistConfig()
+	writeJSON(w, http.StatusOK, configOf(scraper))
+}
+
+func adminDelete(w http.ResponseWriter, id int) {
+	scrapersMutex.Lock()
+	i := scraperIndex(id)
+	if i < 0 {
+		scrapersMutex.Unlock()
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	stopSensor(scrapers[i])
+	scrapers = append(scrapers[:i], scrapers[i+1:]...)
+	updateSupportTexts()
+	scrapersMutex.Unlock()
+
+	log.Printf("Admin API removed scraper %d\n", id)
+	persistConfig()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// scraperFromRequest creates a new scraper from a JSON scraperConfig. If it
+// replaces an old scraper of the same type, the old instance label is kept.
+func scraperFromRequest(r *http.Request, old *Scraper) (*Scraper, error) {
+	var c scraperConfig
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		return nil, errors.New("Could not decode request: " + err.Error())
+	}
+	var interval time.Duration
+	if c.Interval != "" {
+		var err error
+		interval, err = time.ParseDuration(c.Interval)
+		if err != nil {
+			return nil, errors.New("Could not understand scrape interval: " + c.Interval)
+		}
+	}
+	var instance string
+	if old != nil && old.Type == c.Type {
+		instance = old.Instance
+	}
+	return newScraper(c.Type, interval, c.Opts, c.Required || requiredSensors[c.Type], instance)
+}
+
+// scraperIndex returns the index of a scraper in scrapers or -1 if not found.
+// Callers must hold scrapersMutex.
+func scraperIndex(id int) int {
+	for i, s := range scrapers {
+		if s.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// persistConfig writes the scrapers to the config file if the user asked us
+// to do so.
+func persistConfig() {
+	if !*adminPersist || *configFile == "" {
+		return
+	}
+	scrapersMutex.RLock()
+	defer scrapersMutex.RUnlock()
+	if err := writeConfig(*configFile); err != nil {
+		sensor.Incident()
+		log.Printf("Could not persist config to %s. Err: %s\n", *configFile, err)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,176 @@
+//
+// Copyright 2016 Marios Andreopoulos
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// setupAdmin sets the admin flags and an empty list of scrapers, and restores
+// them when the test ends.
+func setupAdmin(t *testing.T, configPath string) {
+	scrapersMutex.Lock()
+	saved := scrapers
+	scrapers = nil
+	scrapersMutex.Unlock()
+	savedToken, savedPersist, savedConfig := *adminToken, *adminPersist, *configFile
+	*adminToken, *adminPersist, *configFile = "secret", configPath != "", configPath
+	t.Cleanup(func() {
+		scrapersMutex.Lock()
+		for _, s := range scrapers {
+			stopSensor(s)
+		}
+		scrapers = saved
+		updateSupportTexts()
+		scrapersMutex.Unlock()
+		*adminToken, *adminPersist, *configFile = savedToken, savedPersist, savedConfig
+	})
+}
+
+func adminRequest(method, path, body, auth string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	if auth != "" {
+		r.Header.Set("Authorization", auth)
+	}
+	w := httptest.NewRecorder()
+	adminHandler(w, r)
+	return w
+}
+
+func TestAdminAuth(t *testing.T) {
+	setupAdmin(t, "")
+	tests := []struct {
+		auth string
+		want int
+	}{
+		{"", http.StatusUnauthorized},
+		{"secret", http.StatusUnauthorized},
+		{"bearer secret", http.StatusUnauthorized},
+		{"Basic secret", http.StatusUnauthorized},
+		{"Bearer wrong", http.StatusUnauthorized},
+		{"Bearer secret2", http.StatusUnauthorized},
+		{"Bearer ", http.StatusUnauthorized},
+		{"Bearer secret", http.StatusOK},
+	}
+	for _, tt := range tests {
+		w := adminRequest(http.MethodGet, "/admin/scrapers", "", tt.auth)
+		if w.Code != tt.want {
+			t.Errorf("Authorization %q got %d, want %d", tt.auth, w.Code, tt.want)
+		}
+		if w.Code == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") != "Bearer" {
+			t.Errorf("Authorization %q got no WWW-Authenticate header", tt.auth)
+		}
+	}
+}
+
+func TestAdminScrapers(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "sensors.conf")
+	setupAdmin(t, file)
+	auth := "Bearer secret"
+	config := func() string {
+		dat, _ := ioutil.ReadFile(file)
+		return string(dat)
+	}
+
+	// A scraper from the command line, which is never persisted.
+	cli, err := newScraper("log", time.Hour, "", false, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addScraper(cli)
+
+	w := adminRequest(http.MethodPost, "/admin/scrapers", `{"type":"example","interval":"1h"}`, auth)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("POST got %d: %s", w.Code, w.Body)
+	}
+	var added scraperConfig
+	if err := json.NewDecoder(w.Body).Decode(&added); err != nil {
+		t.Fatal(err)
+	}
+	if added.Type != "example" || added.Interval != "1h0m0s" || !added.Ready || added.Instance == "" {
+		t.Errorf("POST returned %+v", added)
+	}
+	id := "/admin/scrapers/" + strconv.Itoa(added.ID)
+	if got := config(); !strings.Contains(got, "\nexample,1h0m0s,\n") || strings.Contains(got, "log") {
+		t.Errorf("config after POST:\n%s", got)
+	}
+
+	var list []scraperConfig
+	w = adminRequest(http.MethodGet, "/admin/scrapers", "", auth)
+	if err := json.NewDecoder(w.Body).Decode(&list); err != nil || len(list) != 2 {
+		t.Errorf("GET list returned %v, %v", list, err)
+	}
+	w = adminRequest(http.MethodGet, id, "", auth)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"instance":"`+added.Instance+`"`) {
+		t.Errorf("GET %s got %d: %s", id, w.Code, w.Body)
+	}
+
+	// A change of interval keeps the instance label.
+	w = adminRequest(http.MethodPut, id, `{"type":"example","interval":"2h","required":true}`, auth)
+	var updated scraperConfig
+	json.NewDecoder(w.Body).Decode(&updated)
+	if w.Code != http.StatusOK || updated.ID != added.ID || updated.Instance != added.Instance ||
+		updated.Interval != "2h0m0s" {
+		t.Errorf("PUT got %d: %+v", w.Code, updated)
+	}
+	if got := config(); !strings.Contains(got, "\nrequired example,2h0m0s,\n") || strings.Contains(got, "1h0m0s") {
+		t.Errorf("config after PUT:\n%s", got)
+	}
+
+	// Changing the command line scraper does not persist it.
+	w = adminRequest(http.MethodPut, "/admin/scrapers/"+strconv.Itoa(cli.ID), `{"type":"log","interval":"2h"}`, auth)
+	if w.Code != http.StatusOK || strings.Contains(config(), "log") {
+		t.Errorf("PUT of command line scraper got %d, config:\n%s", w.Code, config())
+	}
+
+	for _, tt := range []struct {
+		method, path, body string
+		want               int
+	}{
+		{http.MethodGet, "/admin/scrapers/999", "", http.StatusNotFound},
+		{http.MethodGet, "/admin/scrapers/abc", "", http.StatusNotFound},
+		{http.MethodPut, "/admin/scrapers/999", `{"type":"example"}`, http.StatusNotFound},
+		{http.MethodPut, id, `{"type":"example","interval":"often"}`, http.StatusBadRequest},
+		{http.MethodPut, id, `{"type":"nosuchsensor"}`, http.StatusBadRequest},
+		{http.MethodPost, "/admin/scrapers", `{"type":`, http.StatusBadRequest},
+		{http.MethodPatch, id, `{}`, http.StatusMethodNotAllowed},
+		{http.MethodDelete, "/admin/scrapers", "", http.StatusMethodNotAllowed},
+		{http.MethodDelete, id, "", http.StatusNoContent},
+		{http.MethodDelete, id, "", http.StatusNotFound},
+	} {
+		if w := adminRequest(tt.method, tt.path, tt.body, auth); w.Code != tt.want {
+			t.Errorf("%s %s got %d, want %d: %s", tt.method, tt.path, w.Code, tt.want, w.Body)
+		}
+	}
+	if got := config(); strings.Contains(got, "example") {
+		t.Errorf("config after DELETE:\n%s", got)
+	}
+	scrapersMutex.RLock()
+	if len(scrapers) != 1 || scrapers[0].ID != cli.ID {
+		t.Errorf("%d scrapers left, want only the command line one", len(scrapers))
+	}
+	scrapersMutex.RUnlock()
+}
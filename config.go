@@ -0,0 +1,110 @@
+//
+// Copyright 2016 Marios Andreopoulos
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// requiredPrefix marks a config line whose sensor is required, like:
+//
+//	required upsc,10s,MYUPS@nas
+const requiredPrefix = "required "
+
+// A configEntry is a sensor set in the config file.
+type configEntry struct {
+	Arg      string
+	Required bool
+}
+
+// readConfig reads a config file. Each line of the file sets a sensor using
+// the same sensor_name,interval,opts format as the command line, optionally
+// prefixed with "required ". Empty lines and lines starting with # are
+// ignored.
+func readConfig(filename string) ([]configEntry, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []configEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		entry := configEntry{Arg: line}
+		if strings.HasPrefix(line, requiredPrefix) {
+			entry = configEntry{Arg: strings.TrimSpace(strings.TrimPrefix(line, requiredPrefix)), Required: true}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// writeConfig writes the scrapers that were set in the config file or
+// through the admin API to a config file. Scrapers set in the command line
+// are left out, since they will be set again from it on restart. The file is
+// first written to a temporary file and then renamed, so a crash won't leave
+// us with a half written config. The temporary file gets the mode of the
+// config file, or 0644 for a new one. Callers must hold scrapersMutex.
+func writeConfig(filename string) error {
+	var out string
+	out += "# Written by sensor_exporter. Format: [required ]sensor_name,interval,opts\n"
+	for _, s := range scrapers {
+		if !s.Persist {
+			continue
+		}
+		if s.Required {
+			out += requiredPrefix
+		}
+		out += fmt.Sprintf("%s,%s,%s\n", s.Type, s.Interval, s.Opts)
+	}
+
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(filename); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(filename), ".sensor_exporter")
+	if err != nil {
+		return err
+	}
+	if err = tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if _, err = tmp.WriteString(out); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), filename)
+}
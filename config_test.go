@@ -0,0 +1,126 @@
+//
+// Copyright 2016 Marios Andreopoulos
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestConfigRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sensor_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "sensors.conf")
+
+	scrapersMutex.Lock()
+	saved := scrapers
+	scrapers = []*Scraper{
+		{Type: "log", Interval: 5 * time.Second, Persist: true},
+		{Type: "example", Interval: time.Second, Opts: "cli"},
+		{Type: "upsc", Interval: 10 * time.Second, Opts: "MYUPS@nas,x", Required: true, Persist: true},
+	}
+	err = writeConfig(file)
+	scrapers = saved
+	scrapersMutex.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := readConfig(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []configEntry{
+		{Arg: "log,5s,"},
+		{Arg: "upsc,10s,MYUPS@nas,x", Required: true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("readConfig() = %#v, want %#v", got, want)
+	}
+}
+
+func TestReadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sensor_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "sensors.conf")
+	conf := "# comment\n\n  log  \nrequired   coretemp\nrequired_sensor,1s\n"
+	if err := ioutil.WriteFile(file, []byte(conf), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := readConfig(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []configEntry{
+		{Arg: "log"},
+		{Arg: "coretemp", Required: true},
+		{Arg: "required_sensor,1s"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("readConfig() = %#v, want %#v", got, want)
+	}
+}
+
+func TestWriteConfigKeepsMode(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		existing bool
+		mode     os.FileMode
+	}{
+		{false, 0644},
+		{true, 0640},
+		{true, 0600},
+	}
+	for _, tt := range tests {
+		file := filepath.Join(dir, "sensors.conf")
+		os.Remove(file)
+		if tt.existing {
+			if err := ioutil.WriteFile(file, nil, tt.mode); err != nil {
+				t.Fatal(err)
+			}
+			// WriteFile's mode is subject to the umask.
+			if err := os.Chmod(file, tt.mode); err != nil {
+				t.Fatal(err)
+			}
+		}
+		scrapersMutex.Lock()
+		err := writeConfig(file)
+		scrapersMutex.Unlock()
+		if err != nil {
+			t.Fatal(err)
+		}
+		info, err := os.Stat(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != tt.mode {
+			t.Errorf("existing=%v: config file mode is %o, want %o", tt.existing, info.Mode().Perm(), tt.mode)
+		}
+	}
+}
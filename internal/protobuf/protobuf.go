@@ -0,0 +1,106 @@
+//
+// Copyright 2016 Marios Andreopoulos
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+/*
+Package protobuf implements the little of the protocol buffers wire format
+that our sinks need to encode their messages. Messages are built by appending
+fields to a byte slice, in field order.
+
+See <https://protobuf.dev/programming-guides/encoding/>.
+*/
+package protobuf
+
+import (
+	"math"
+)
+
+// Wire types
+const (
+	varintType  = 0
+	fixed64Type = 1
+	bytesType   = 2
+	fixed32Type = 5
+)
+
+// AppendVarint appends an unsigned varint.
+func AppendVarint(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+func appendTag(b []byte, field int, wireType int) []byte {
+	return AppendVarint(b, uint64(field)<<3|uint64(wireType))
+}
+
+// AppendUint64 appends a uint64 (or uint32, enum, bool) field. Zero values are
+// skipped, as proto3 does.
+func AppendUint64(b []byte, field int, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = appendTag(b, field, varintType)
+	return AppendVarint(b, v)
+}
+
+// AppendInt64 appends an int64 (or int32) field.
+func AppendInt64(b []byte, field int, v int64) []byte {
+	return AppendUint64(b, field, uint64(v))
+}
+
+// AppendBool appends a bool field.
+func AppendBool(b []byte, field int, v bool) []byte {
+	if !v {
+		return b
+	}
+	return AppendUint64(b, field, 1)
+}
+
+// AppendFixed64 appends a fixed64 field. Unlike the other functions, zero
+// values are written, since fixed64 is often used for timestamps in oneofs.
+func AppendFixed64(b []byte, field int, v uint64) []byte {
+	b = appendTag(b, field, fixed64Type)
+	for i := 0; i < 8; i++ {
+		b = append(b, byte(v>>(8*uint(i))))
+	}
+	return b
+}
+
+// AppendDouble appends a double field. Zero values are written, so it can be
+// used for oneof members.
+func AppendDouble(b []byte, field int, v float64) []byte {
+	return AppendFixed64(b, field, math.Float64bits(v))
+}
+
+// AppendBytes appends a bytes field or an embedded message.
+func AppendBytes(b []byte, field int, v []byte) []byte {
+	b = appendTag(b, field, bytesType)
+	b = AppendVarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+// AppendString appends a string field. Empty strings are skipped.
+func AppendString(b []byte, field int, v string) []byte {
+	if v == "" {
+		return b
+	}
+	b = appendTag(b, field, bytesType)
+	b = AppendVarint(b, uint64(len(v)))
+	return append(b, v...)
+}
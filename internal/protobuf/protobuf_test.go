@@ -0,0 +1,74 @@
+//
+// Copyright 2016 Marios Andreopoulos
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package protobuf
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestAppendVarint(t *testing.T) {
+	tests := []struct {
+		v    uint64
+		want []byte
+	}{
+		{0, []byte{0x00}},
+		{1, []byte{0x01}},
+		{127, []byte{0x7f}},
+		{128, []byte{0x80, 0x01}},
+		{300, []byte{0xac, 0x02}},
+		{1<<64 - 1, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01}},
+	}
+	for _, tt := range tests {
+		if got := AppendVarint(nil, tt.v); !bytes.Equal(got, tt.want) {
+			t.Errorf("AppendVarint(%d) = %x, want %x", tt.v, got, tt.want)
+		}
+	}
+}
+
+// The expected encodings are the examples of the protobuf encoding guide, or
+// follow from them.
+func TestAppendFields(t *testing.T) {
+	tests := []struct {
+		name string
+		got  []byte
+		want []byte
+	}{
+		{"uint64", AppendUint64(nil, 1, 150), []byte{0x08, 0x96, 0x01}},
+		{"zero uint64", AppendUint64(nil, 1, 0), nil},
+		{"negative int64", AppendInt64(nil, 2, -1),
+			[]byte{0x10, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01}},
+		{"bool", AppendBool(nil, 3, true), []byte{0x18, 0x01}},
+		{"false bool", AppendBool(nil, 3, false), nil},
+		{"string", AppendString(nil, 2, "testing"), []byte{0x12, 0x07, 't', 'e', 's', 't', 'i', 'n', 'g'}},
+		{"empty string", AppendString(nil, 2, ""), nil},
+		{"embedded message", AppendBytes(nil, 3, AppendUint64(nil, 1, 150)), []byte{0x1a, 0x03, 0x08, 0x96, 0x01}},
+		{"empty bytes", AppendBytes(nil, 1, nil), []byte{0x0a, 0x00}},
+		{"fixed64", AppendFixed64(nil, 2, 0x0102030405060708),
+			[]byte{0x11, 0x08, 0x07, 0x06, 0x05, 0x04, 0x03, 0x02, 0x01}},
+		{"zero fixed64", AppendFixed64(nil, 3, 0), []byte{0x19, 0, 0, 0, 0, 0, 0, 0, 0}},
+		{"double", AppendDouble(nil, 4, 1), []byte{0x21, 0, 0, 0, 0, 0, 0, 0xf0, 0x3f}},
+		{"large field number", AppendUint64(nil, 16, 1), []byte{0x80, 0x01, 0x01}},
+		{"appended fields", AppendString(AppendUint64(nil, 1, 150), 2, "a"), []byte{0x08, 0x96, 0x01, 0x12, 0x01, 'a'}},
+	}
+	for _, tt := range tests {
+		if !bytes.Equal(tt.got, tt.want) {
+			t.Errorf("%s = %x, want %x", tt.name, tt.got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+//
+// Copyright 2016 Marios Andreopoulos
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+/*
+Package snappy implements a simple encoder for the snappy block format, as
+used by the Prometheus remote write protocol. It favours simplicity over
+compression ratio; its output can be read by any snappy decoder.
+
+See <https://github.com/google/snappy/blob/main/format_description.txt>.
+*/
+package snappy
+
+import (
+	"encoding/binary"
+)
+
+const (
+	tagLiteral = 0x00
+	tagCopy2   = 0x02
+
+	hashBits  = 14
+	maxOffset = 1<<16 - 1
+)
+
+// Encode returns the snappy block encoding of src.
+func Encode(src []byte) []byte {
+	dst := make([]byte, 0, len(src)/2+16)
+	dst = appendUvarint(dst, uint64(len(src)))
+	if len(src) < 4 {
+		return emitLiteral(dst, src)
+	}
+
+	// table keeps the last position (plus one) where each 4 byte hash was seen.
+	var table [1 << hashBits]int32
+	lit, i := 0, 0
+	for i+4 <= len(src) {
+		cur := binary.LittleEndian.Uint32(src[i:])
+		h := (cur * 0x1e35a7bd) >> (32 - hashBits)
+		candidate := int(table[h]) - 1
+		table[h] = int32(i + 1)
+		if candidate < 0 || i-candidate > maxOffset ||
+			binary.LittleEndian.Uint32(src[candidate:]) != cur {
+			i++
+			continue
+		}
+
+		n := 4
+		for i+n < len(src) && src[candidate+n] == src[i+n] {
+			n++
+		}
+		dst = emitLiteral(dst, src[lit:i])
+		dst = emitCopy(dst, i-candidate, n)
+		i += n
+		lit = i
+	}
+	return emitLiteral(dst, src[lit:])
+}
+
+func appendUvarint(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+func emitLiteral(dst, lit []byte) []byte {
+	if len(lit) == 0 {
+		return dst
+	}
+	n := len(lit) - 1
+	switch {
+	case n < 60:
+		dst = append(dst, byte(n)<<2|tagLiteral)
+	case n < 1<<8:
+		dst = append(dst, 60<<2|tagLiteral, byte(n))
+	case n < 1<<16:
+		dst = append(dst, 61<<2|tagLiteral, byte(n), byte(n>>8))
+	case n < 1<<24:
+		dst = append(dst, 62<<2|tagLiteral, byte(n), byte(n>>8), byte(n>>16))
+	default:
+		dst = append(dst, 63<<2|tagLiteral, byte(n), byte(n>>8), byte(n>>16), byte(n>>24))
+	}
+	return append(dst, lit...)
+}
+
+// emitCopy writes copy elements with 2 byte offsets. Each may copy up to 64
+// bytes, so long matches are split.
+func emitCopy(dst []byte, offset, length int) []byte {
+	for length > 0 {
+		n := length
+		if n > 64 {
+			n = 64
+		}
+		dst = append(dst, byte(n-1)<<2|tagCopy2, byte(offset), byte(offset>>8))
+		length -= n
+	}
+	return dst
+}
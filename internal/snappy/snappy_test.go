@@ -0,0 +1,143 @@
+//
+// Copyright 2016 Marios Andreopoulos
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package snappy
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// decode is a plain snappy block decoder, written from the format
+// description, for checking that what we encode can be read back.
+func decode(src []byte) ([]byte, error) {
+	length, n := binary.Uvarint(src)
+	if n <= 0 {
+		return nil, errors.New("bad length")
+	}
+	src = src[n:]
+	var dst []byte
+	for len(src) > 0 {
+		tag := src[0]
+		switch tag & 0x03 {
+		case tagLiteral:
+			l := int(tag >> 2)
+			src = src[1:]
+			if l >= 60 {
+				extra := l - 59
+				if len(src) < extra {
+					return nil, errors.New("short literal length")
+				}
+				l = 0
+				for i := 0; i < extra; i++ {
+					l |= int(src[i]) << (8 * uint(i))
+				}
+				src = src[extra:]
+			}
+			l++
+			if len(src) < l {
+				return nil, errors.New("short literal")
+			}
+			dst = append(dst, src[:l]...)
+			src = src[l:]
+		case 0x01:
+			if len(src) < 2 {
+				return nil, errors.New("short copy1")
+			}
+			l := int(tag>>2&0x07) + 4
+			offset := int(tag>>5)<<8 | int(src[1])
+			src = src[2:]
+			if offset == 0 || offset > len(dst) {
+				return nil, errors.New("bad offset")
+			}
+			for i := 0; i < l; i++ {
+				dst = append(dst, dst[len(dst)-offset])
+			}
+		case tagCopy2:
+			if len(src) < 3 {
+				return nil, errors.New("short copy2")
+			}
+			l := int(tag>>2) + 1
+			offset := int(src[1]) | int(src[2])<<8
+			src = src[3:]
+			if offset == 0 || offset > len(dst) {
+				return nil, errors.New("bad offset")
+			}
+			for i := 0; i < l; i++ {
+				dst = append(dst, dst[len(dst)-offset])
+			}
+		default:
+			return nil, errors.New("copy4 is not expected")
+		}
+	}
+	if uint64(len(dst)) != length {
+		return nil, errors.New("length does not match")
+	}
+	return dst, nil
+}
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		src  string
+		want []byte
+	}{
+		{"", []byte{0x00}},
+		{"abc", []byte{0x03, 0x08, 'a', 'b', 'c'}},
+		{"abcdabcdabcd", []byte{0x0c, 0x0c, 'a', 'b', 'c', 'd', 0x1e, 0x04, 0x00}},
+		// Matches longer than 64 bytes are split.
+		{strings.Repeat("a", 100), []byte{0x64, 0x00, 'a', 0xfe, 0x01, 0x00, 0x8a, 0x01, 0x00}},
+	}
+	for _, tt := range tests {
+		if got := Encode([]byte(tt.src)); !bytes.Equal(got, tt.want) {
+			t.Errorf("Encode(%q) = %x, want %x", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	random := make([]byte, 100000)
+	r.Read(random)
+	// Text with repetitions, like the series of a write request.
+	var text bytes.Buffer
+	for i := 0; i < 2000; i++ {
+		text.WriteString("cpu_temperature_celsius{sensor=\"Core ")
+		text.WriteByte(byte('0' + r.Intn(10)))
+		text.WriteString("\"} 4")
+		text.WriteByte(byte('0' + r.Intn(10)))
+		text.WriteString("\n")
+	}
+	for _, src := range [][]byte{nil, []byte("a"), []byte("abcd"), random[:59], random[:60], random[:300],
+		random[:70000], random, text.Bytes(), bytes.Repeat([]byte{0}, 200000)} {
+		encoded := Encode(src)
+		got, err := decode(encoded)
+		if err != nil {
+			t.Errorf("could not decode encoding of %d bytes: %s", len(src), err)
+			continue
+		}
+		if !bytes.Equal(got, src) {
+			t.Errorf("round trip of %d bytes does not match", len(src))
+		}
+	}
+	if n := len(Encode(text.Bytes())); n > text.Len()/2 {
+		t.Errorf("text of %d bytes was only compressed to %d", text.Len(), n)
+	}
+}
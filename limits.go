@@ -0,0 +1,171 @@
+//
+// Copyright 2016 Marios Andreopoulos
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/andmarios/sensor_exporter/sensor"
+)
+
+// Limits protect us from sensors that return too much data. A zero value
+// means no limit. Action is either "truncate" (drop the excess series) or
+// "reject" (drop the whole scrape).
+type Limits struct {
+	Series int
+	Labels int
+	Bytes  int
+	Action string
+}
+
+const (
+	limitTruncate = "truncate"
+	limitReject   = "reject"
+)
+
+// limitFlags holds per sensor type overrides of the default limits. It
+// implements flag.Value so it can be set multiple times, like:
+//
+//	-limit upsc:series=50,bytes=8192,action=reject
+type limitFlags map[string]Limits
+
+func (l limitFlags) String() string {
+	var s []string
+	for k, v := range l {
+		s = append(s, fmt.Sprintf("%s:series=%d,labels=%d,bytes=%d,action=%s",
+			k, v.Series, v.Labels, v.Bytes, v.Action))
+	}
+	return strings.Join(s, " ")
+}
+
+func (l limitFlags) Set(value string) error {
+	conf := strings.SplitN(value, ":", 2)
+	if len(conf) != 2 || conf[0] == "" {
+		return errors.New("limit should be like TYPE:series=N,labels=N,bytes=N,action=truncate|reject")
+	}
+	limits, exists := l[conf[0]]
+	if !exists { // Negative or empty values mean use the default
+		limits = Limits{Series: -1, Labels: -1, Bytes: -1}
+	}
+	for _, opt := range strings.Split(conf[1], ",") {
+		kv := strings.SplitN(opt, "=", 2)
+		if len(kv) != 2 {
+			return errors.New("could not understand limit option: " + opt)
+		}
+		if kv[0] == "action" {
+			if kv[1] != limitTruncate && kv[1] != limitReject {
+				return errors.New("limit action should be truncate or reject, not " + kv[1])
+			}
+			limits.Action = kv[1]
+			continue
+		}
+		n, err := strconv.Atoi(kv[1])
+		if err != nil || n < 0 {
+			return errors.New("limit " + kv[0] + " should be a non negative number")
+		}
+		switch kv[0] {
+		case "series":
+			limits.Series = n
+		case "labels":
+			limits.Labels = n
+		case "bytes":
+			limits.Bytes = n
+		default:
+			return errors.New("unknown limit: " + kv[0])
+		}
+	}
+	l[conf[0]] = limits
+	return nil
+}
+
+// limitsFor returns the limits that apply to a sensor type.
+func limitsFor(sensorType string) Limits {
+	l := Limits{Series: *maxSeries, Labels: *maxLabels, Bytes: *maxBytes, Action: *limitAction}
+	if o, exists := sensorLimits[sensorType]; exists {
+		if o.Series >= 0 {
+			l.Series = o.Series
+		}
+		if o.Labels >= 0 {
+			l.Labels = o.Labels
+		}
+		if o.Bytes >= 0 {
+			l.Bytes = o.Bytes
+		}
+		if o.Action != "" {
+			l.Action = o.Action
+		}
+	}
+	return l
+}
+
+// Enforce checks a scrape's output against the limits. It returns the output
+// that should be exposed and the number of series the sensor returned.
+// Whenever a limit is hit, a labelled incident is raised.
+func (l Limits) Enforce(sensorType, out string) (string, int) {
+	lines := sensor.SeriesLines(out)
+	series := len(lines)
+	if l.Series == 0 && l.Labels == 0 && l.Bytes == 0 {
+		return out, series
+	}
+
+	var kept []string
+	var size int
+	var reason string
+	for _, line := range lines {
+		// Lines dropped by the labels limit do not count towards the series limit.
+		if l.Series > 0 && len(kept) >= l.Series {
+			reason = "series"
+			break
+		}
+		if l.Labels > 0 {
+			s, err := sensor.ParseSample(line)
+			if err == nil && len(s.Labels) > l.Labels {
+				reason = "labels"
+				if l.Action == limitReject {
+					break
+				}
+				continue
+			}
+		}
+		if l.Bytes > 0 && size+len(line)+1 > l.Bytes {
+			reason = "bytes"
+			break
+		}
+		size += len(line) + 1
+		kept = append(kept, line)
+	}
+
+	if reason == "" {
+		return out, series
+	}
+	if l.Action == limitReject {
+		sensor.LabelledIncident(sensorType, "limit_"+reason+"_rejected")
+		log.Printf("Sensor %s hit its %s limit, rejecting scrape with %d series.\n", sensorType, reason, series)
+		return "", series
+	}
+	sensor.LabelledIncident(sensorType, "limit_"+reason+"_truncated")
+	log.Printf("Sensor %s hit its %s limit, keeping %d of %d series.\n", sensorType, reason, len(kept), series)
+	if len(kept) == 0 {
+		return "", series
+	}
+	return strings.Join(kept, "\n") + "\n", series
+}
@@ -0,0 +1,98 @@
+//
+// Copyright 2016 Marios Andreopoulos
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"testing"
+
+	"github.com/andmarios/sensor_exporter/sensor"
+)
+
+func TestEnforce(t *testing.T) {
+	out := "# TYPE m gauge\n" +
+		"m{a=\"1\"} 1\n" +
+		"m{a=\"2\",b=\"2\",c=\"2\"} 2\n" +
+		"m{a=\"3\"} 3\n"
+
+	tests := []struct {
+		name   string
+		limits Limits
+		want   string
+		reason string
+	}{
+		{"no limits", Limits{}, out, ""},
+		{"within limits", Limits{Series: 3, Labels: 3, Bytes: 1000, Action: limitReject}, out, ""},
+		{"series truncate", Limits{Series: 2, Action: limitTruncate},
+			"m{a=\"1\"} 1\nm{a=\"2\",b=\"2\",c=\"2\"} 2\n", "limit_series_truncated"},
+		{"series reject", Limits{Series: 2, Action: limitReject}, "", "limit_series_rejected"},
+		{"labels truncate", Limits{Labels: 2, Action: limitTruncate},
+			"m{a=\"1\"} 1\nm{a=\"3\"} 3\n", "limit_labels_truncated"},
+		{"labels reject", Limits{Labels: 2, Action: limitReject}, "", "limit_labels_rejected"},
+		{"series and labels truncate", Limits{Series: 2, Labels: 2, Action: limitTruncate},
+			"m{a=\"1\"} 1\nm{a=\"3\"} 3\n", "limit_labels_truncated"},
+		{"series and labels both hit", Limits{Series: 1, Labels: 2, Action: limitTruncate},
+			"m{a=\"1\"} 1\n", "limit_series_truncated"},
+		{"bytes truncate", Limits{Bytes: 20, Action: limitTruncate},
+			"m{a=\"1\"} 1\n", "limit_bytes_truncated"},
+		{"bytes exact", Limits{Bytes: 11, Action: limitTruncate},
+			"m{a=\"1\"} 1\n", "limit_bytes_truncated"},
+		{"bytes truncate all", Limits{Bytes: 5, Action: limitTruncate}, "", "limit_bytes_truncated"},
+		{"bytes reject", Limits{Bytes: 20, Action: limitReject}, "", "limit_bytes_rejected"},
+	}
+	for _, tt := range tests {
+		sensorType := "test_" + tt.name
+		before := sensor.GetLabelledIncidents()
+		got, series := tt.limits.Enforce(sensorType, out)
+		if got != tt.want {
+			t.Errorf("%s: Enforce() = %q, want %q", tt.name, got, tt.want)
+		}
+		if series != 3 {
+			t.Errorf("%s: Enforce() counted %d series, want 3", tt.name, series)
+		}
+		incidents := sensor.GetLabelledIncidents()
+		for label, n := range incidents {
+			if label.Sensor != sensorType {
+				continue
+			}
+			if n -= before[label]; n != 0 && (label.Reason != tt.reason || n != 1) {
+				t.Errorf("%s: got incident %s x%d, want %q", tt.name, label.Reason, n, tt.reason)
+			}
+		}
+		label := sensor.IncidentLabel{Sensor: sensorType, Reason: tt.reason}
+		if tt.reason != "" && incidents[label]-before[label] != 1 {
+			t.Errorf("%s: no %s incident raised", tt.name, tt.reason)
+		}
+	}
+}
+
+func TestLimitFlags(t *testing.T) {
+	l := make(limitFlags)
+	if err := l.Set("upsc:series=50,bytes=8192,action=reject"); err != nil {
+		t.Fatal(err)
+	}
+	want := Limits{Series: 50, Labels: -1, Bytes: 8192, Action: limitReject}
+	if l["upsc"] != want {
+		t.Errorf("limit = %+v, want %+v", l["upsc"], want)
+	}
+	for _, bad := range []string{"series=1", ":series=1", "upsc:series", "upsc:series=-1",
+		"upsc:action=drop", "upsc:rows=1"} {
+		if err := l.Set(bad); err == nil {
+			t.Errorf("Set(%q) did not fail", bad)
+		}
+	}
+}
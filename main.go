@@ -29,22 +29,54 @@ import (
 
 	"github.com/andmarios/sensor_exporter/sensor"
 	_ "github.com/andmarios/sensor_exporter/sensor_coretemp"
+	_ "github.com/andmarios/sensor_exporter/sensor_cpufreq"
+	_ "github.com/andmarios/sensor_exporter/sensor_drivetemp"
 	_ "github.com/andmarios/sensor_exporter/sensor_example"
 	_ "github.com/andmarios/sensor_exporter/sensor_hddtemp"
+	_ "github.com/andmarios/sensor_exporter/sensor_hwmon"
 	_ "github.com/andmarios/sensor_exporter/sensor_log"
+	_ "github.com/andmarios/sensor_exporter/sensor_nvme"
+	_ "github.com/andmarios/sensor_exporter/sensor_power_supply"
+	_ "github.com/andmarios/sensor_exporter/sensor_rapl"
+	_ "github.com/andmarios/sensor_exporter/sensor_thermal"
 	_ "github.com/andmarios/sensor_exporter/sensor_upsc"
+	_ "github.com/andmarios/sensor_exporter/sensor_w1"
+	_ "github.com/andmarios/sensor_exporter/sink_agentx"
+	_ "github.com/andmarios/sensor_exporter/sink_example"
+	_ "github.com/andmarios/sensor_exporter/sink_file"
+	_ "github.com/andmarios/sensor_exporter/sink_graphite"
+	_ "github.com/andmarios/sensor_exporter/sink_influxdb"
+	_ "github.com/andmarios/sensor_exporter/sink_mqtt"
+	_ "github.com/andmarios/sensor_exporter/sink_otlp"
+	_ "github.com/andmarios/sensor_exporter/sink_pushgateway"
+	_ "github.com/andmarios/sensor_exporter/sink_remotewrite"
+	_ "github.com/andmarios/sensor_exporter/sink_statsd"
 )
 
 type Scraper struct {
+	ID        int
 	Collector sensor.Collector
 	Interval  time.Duration
 	Type      string
+	Instance  string
+	Opts      string
 	Value     string
+	Series    int
+	Limits    Limits
+	Required  bool
+	Ready     bool
+	Persist   bool // set in the config file or the admin API
 	Mutex     *sync.RWMutex
+	stop      chan struct{}
 }
 
+// scrapersMutex protects scrapers and supportTexts, which may change at
+// runtime through the admin API.
+var scrapersMutex sync.RWMutex
 var scrapers []*Scraper
 var supportTexts = make(map[string]bool)
+var nextScraperID = 1
+var instancesPerType = make(map[string]int)
 
 var (
 	defaultInterval = time.Duration(4800) * time.Millisecond
@@ -53,10 +85,37 @@ var (
 var (
 	port        = flag.String("p", "9091", "port to listen on")
 	listSensors = flag.Bool("list-sensors", false, "list available sensors")
+	listSinks   = flag.Bool("list-sinks", false, "list available sinks")
+	configFile  = flag.String("config", "", "file with sensors to load, one sensor_name,interval,opts per line")
+	maxSeries   = flag.Int("max-series", 0, "maximum number of series a sensor may return per scrape (0 for no limit)")
+	maxLabels   = flag.Int("max-labels", 0, "maximum number of labels a series may have (0 for no limit)")
+	maxBytes    = flag.Int("max-bytes", 0, "maximum size in bytes of a sensor's scrape output (0 for no limit)")
+	limitAction = flag.String("limit-action", limitTruncate, "what to do when a sensor exceeds a limit: truncate or reject")
+	resilient   = flag.Bool("resilient", false, "keep retrying sensors that fail to initialize instead of exiting")
+	retryEvery  = flag.Duration("retry-interval", 10*time.Second, "how often to retry sensors that are not ready in resilient mode")
+	required    = flag.String("required", "", "comma separated sensor types that must initialize even in resilient mode")
 )
 
+var requiredSensors = make(map[string]bool)
+
+var sensorLimits = make(limitFlags)
+var sinkArgs sinkFlags
+
+func init() {
+	flag.Var(&sinkArgs, "sink", "sink to send scrapes to, like sink_name,buffer,opts (may be repeated)")
+	flag.Var(sensorLimits, "limit", "per sensor type limits, like TYPE:series=N,labels=N,bytes=N,action=reject (may be repeated)")
+}
+
 func main() {
 	flag.Parse()
+	if *limitAction != limitTruncate && *limitAction != limitReject {
+		log.Fatalf("Limit action should be %s or %s, not %s\n", limitTruncate, limitReject, *limitAction)
+	}
+	for _, v := range strings.Split(*required, ",") {
+		if v != "" {
+			requiredSensors[v] = true
+		}
+	}
 
 	if *listSensors {
 		for k, v := range sensor.AvailableCollectors {
@@ -65,16 +124,50 @@ func main() {
 		}
 		return
 	}
+	if *listSinks {
+		for k, v := range sensor.AvailableSinks {
+			fmt.Printf("SINK %s\n%s\n\n", k, v.Description)
+		}
+		return
+	}
 	for k, _ := range sensor.AvailableCollectors {
 		log.Printf("Found sensor type %s\n", k)
 	}
+	for k, _ := range sensor.AvailableSinks {
+		log.Printf("Found sink type %s\n", k)
+	}
+
+	// Sinks are started first, so they get the sensors' first scrapes too.
+	for _, v := range sinkArgs {
+		sink, err := processSinkArg(v)
+		if err != nil {
+			log.Fatalf("Could not add sink “%s”. Err: %s\n", v, err)
+		}
+		sinks = append(sinks, sink)
+		startSink(sink)
+	}
+
+	if *configFile != "" {
+		config, err := readConfig(*configFile)
+		if err != nil {
+			log.Fatalf("Could not read config file %s. Err: %s\n", *configFile, err)
+		}
+		for _, v := range config {
+			scraper, err := processArg(v.Arg, v.Required)
+			if err != nil {
+				log.Fatalf("Could not add “%s”. Err: %s\n", v.Arg, err)
+			}
+			scraper.Persist = true
+			addScraper(scraper)
+		}
+	}
 
 	for _, v := range flag.Args() {
-		scraper, err := processArg(v)
+		scraper, err := processArg(v, false)
 		if err != nil {
 			log.Fatalf("Could not add “%s”. Err: %s\n", v, err)
 		}
-		scrapers = append(scrapers, scraper)
+		addScraper(scraper)
 	}
 
 	log.Println("Initializing sensors")
@@ -82,6 +175,15 @@ func main() {
 		startSensor(v)
 	}
 
+	if *adminToken != "" {
+		if *adminPersist && *configFile == "" {
+			log.Println("Admin API changes will not be persisted since no config file is set")
+		}
+		log.Println("Enabling admin API under /admin/scrapers")
+		http.HandleFunc("/admin/scrapers", adminHandler)
+		http.HandleFunc("/admin/scrapers/", adminHandler)
+	}
+
 	log.Printf("Initialization succesful. Listening on :%s\n", *port)
 	http.HandleFunc("/metrics", metricsHandler)
 	http.ListenAndServe(":"+*port, nil)
@@ -89,23 +191,25 @@ func main() {
 }
 
 func startSensor(s *Scraper) {
-	var start time.Time
-	var end time.Duration
 	go func() {
-		tick := time.Tick(s.Interval)
+		if !s.isReady() && !s.retryInit() {
+			return
+		}
+		ticker := time.NewTicker(s.Interval)
+		defer ticker.Stop()
 		for {
 			select {
-			case <-tick:
-				start = time.Now()
+			case <-s.stop:
+				return
+			case <-ticker.C:
+				start := time.Now()
 				value, err := s.Collector.Scrape()
 				if err != nil {
 					log.Printf("Could not scrape %s. Err: %s\n", s.Type, err)
 					continue
 				}
-				end = time.Since(start)
-				s.Mutex.Lock()
-				s.Value = value
-				s.Mutex.Unlock()
+				end := time.Since(start)
+				s.update(value)
 				// If it took too long for the scrape to finish, report it.
 				if end > s.Interval {
 					sensor.Incident()
@@ -116,20 +220,93 @@ func startSensor(s *Scraper) {
 	}()
 }
 
+// retryInit keeps trying to initialize a scraper until it succeeds or the
+// scraper is stopped. It returns true if the scraper is ready.
+func (s *Scraper) retryInit() bool {
+	ticker := time.NewTicker(*retryEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return false
+		case <-ticker.C:
+			err := s.init()
+			if err == nil {
+				log.Printf("Sensor %s is now ready\n", s.Type)
+				return true
+			}
+			log.Printf("Sensor %s is still not ready. Err: %s\n", s.Type, err)
+		}
+	}
+}
+
+// stopSensor stops the scrape loop of a scraper started with startSensor.
+func stopSensor(s *Scraper) {
+	close(s.stop)
+}
+
+// addScraper assigns an ID to a scraper and adds it to our scrapers list.
+// It does not start it.
+func addScraper(s *Scraper) {
+	scrapersMutex.Lock()
+	defer scrapersMutex.Unlock()
+	s.ID = nextScraperID
+	nextScraperID++
+	scrapers = append(scrapers, s)
+	updateSupportTexts()
+}
+
+// newInstance returns the next instance label for a sensor type, like
+// coretemp-1, coretemp-2. Instances allow the same sensor type to be used more
+// than once, e.g with different intervals.
+func newInstance(sensorType string) string {
+	scrapersMutex.Lock()
+	defer scrapersMutex.Unlock()
+	instancesPerType[sensorType]++
+	return fmt.Sprintf("%s-%d", sensorType, instancesPerType[sensorType])
+}
+
+// updateSupportTexts rebuilds the TYPE and HELP texts from the current
+// scrapers. Callers must hold scrapersMutex.
+func updateSupportTexts() {
+	supportTexts = make(map[string]bool)
+	for _, s := range scrapers {
+		entry := sensor.AvailableCollectors[s.Type]
+		for k, _ := range entry.Type {
+			supportTexts[entry.Type[k]] = true
+			supportTexts[entry.Help[k]] = true
+		}
+	}
+}
+
 func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	scrapersMutex.RLock()
+	defer scrapersMutex.RUnlock()
 	for k, _ := range supportTexts {
 		fmt.Fprintln(w, k)
 	}
+	fmt.Fprintln(w, "# TYPE sensor_exporter_sensor_series gauge")
+	fmt.Fprintln(w, "# HELP sensor_exporter_sensor_series Number of series each sensor returned on its last scrape, before limits were applied.")
+	fmt.Fprintln(w, "# TYPE sensor_exporter_sensor_ready gauge")
+	fmt.Fprintln(w, "# HELP sensor_exporter_sensor_ready Whether a sensor has been initialized and performed its first scrape.")
 	for _, v := range scrapers {
 		v.Mutex.RLock()
+		ready := 0
+		if v.Ready {
+			ready = 1
+		}
 		fmt.Fprintln(w, v.Value)
+		fmt.Fprintf(w, "sensor_exporter_sensor_series{sensor=\"%s\",instance=\"%s\"} %d\n", v.Type, v.Instance, v.Series)
+		fmt.Fprintf(w, "sensor_exporter_sensor_ready{sensor=\"%s\",instance=\"%s\"} %d\n", v.Type, v.Instance, ready)
 		v.Mutex.RUnlock()
 	}
+	writeSinkMetrics(w)
 }
 
-func processArg(arg string) (*Scraper, error) {
+// processArg creates a scraper from a sensor_name,interval,opts string. The
+// scraper is required if required is set or its type is in -required.
+func processArg(arg string, required bool) (*Scraper, error) {
 	conf := strings.SplitN(arg, ",", 3)
-	//var scraper sensor.Scraper
 	var interval time.Duration
 	var opts string
 	var err error
@@ -145,36 +322,82 @@ func processArg(arg string) (*Scraper, error) {
 			interval = 0
 		}
 		fallthrough
-	case 1: // Check sensor and if needed default intervals
-		if _, exists := sensor.AvailableCollectors[conf[0]]; !exists {
-			return nil, errors.New("Sensor " + conf[0] + " not found")
-		}
-		if interval == 0 { // Try to assign scraper's suggested interval
-			interval = sensor.AvailableCollectors[conf[0]].DefaultInterval
-		}
-		if interval == 0 { // Assign our interval if all else failed
-			interval = defaultInterval
-		}
-		// Add sensors TYPE and HELP texts if needed to our supportTexts list
-		for k, _ := range sensor.AvailableCollectors[conf[0]].Type {
-			supportTexts[sensor.AvailableCollectors[conf[0]].Type[k]] = true
-			supportTexts[sensor.AvailableCollectors[conf[0]].Help[k]] = true
-		}
-
+	case 1:
+		return newScraper(conf[0], interval, opts, required || requiredSensors[conf[0]], "")
 	default:
 		return nil, errors.New("Could not create sensor")
 	}
+}
+
+// newScraper creates a scraper for a sensor type and performs its first
+// scrape. If interval is zero, the sensor's suggested interval is used. In
+// resilient mode, a scraper that is not required is returned even if it
+// could not be initialized; it will keep retrying once started. If instance
+// is empty, a new instance label is assigned.
+func newScraper(sensorType string, interval time.Duration, opts string, required bool, instance string) (*Scraper, error) {
+	// Check sensor and if needed default intervals
+	if _, exists := sensor.AvailableCollectors[sensorType]; !exists {
+		return nil, errors.New("Sensor " + sensorType + " not found")
+	}
+	if interval == 0 { // Try to assign scraper's suggested interval
+		interval = sensor.AvailableCollectors[sensorType].DefaultInterval
+	}
+	if interval == 0 { // Assign our interval if all else failed
+		interval = defaultInterval
+	}
+
+	if instance == "" {
+		instance = newInstance(sensorType)
+	}
+
+	log.Printf("Adding scraper for sensor %s (%s) with interval %s and opts: %s\n", sensorType, instance, interval, opts)
 
-	log.Printf("Adding scraper for sensor %s with interval %s and opts: %s\n", conf[0], interval, opts)
+	scraper := &Scraper{Interval: interval, Type: sensorType, Instance: instance, Opts: opts, Limits: limitsFor(sensorType),
+		Required: required, Mutex: &sync.RWMutex{}, stop: make(chan struct{})}
+	err := scraper.init()
+	if err != nil {
+		if !*resilient || required {
+			return nil, err
+		}
+		sensor.LabelledIncident(sensorType, "not_ready")
+		log.Printf("Sensor %s is not ready, will retry every %s. Err: %s\n", sensorType, *retryEvery, err)
+	}
+	return scraper, nil
+}
 
-	collector, err := sensor.AvailableCollectors[conf[0]].New(opts)
+// init creates the scraper's collector and performs its first scrape. If both
+// succeed, the scraper is marked as ready.
+func (s *Scraper) init() error {
+	collector, err := sensor.AvailableCollectors[s.Type].New(s.Opts)
 	if err != nil {
-		return nil, errors.New("Could not init sensor: " + err.Error())
+		return errors.New("Could not init sensor: " + err.Error())
 	}
 	value, err := collector.Scrape()
 	if err != nil {
-		return nil, errors.New("Could not perform first scrape: " + err.Error())
+		return errors.New("Could not perform first scrape: " + err.Error())
 	}
-	scraper := &Scraper{collector, interval, conf[0], value, &sync.RWMutex{}}
-	return scraper, nil
+	s.Mutex.Lock()
+	s.Collector = collector
+	s.Ready = true
+	s.Mutex.Unlock()
+	s.update(value)
+	return nil
+}
+
+// update enforces the limits on a scrape's output, adds the instance label
+// and stores it as the scraper's value.
+func (s *Scraper) update(value string) {
+	value, series := s.Limits.Enforce(s.Type, value)
+	value = sensor.AddLabel(value, "instance", s.Instance)
+	s.Mutex.Lock()
+	s.Value = value
+	s.Series = series
+	s.Mutex.Unlock()
+	dispatch(sensor.Scrape{Sensor: s.Type, Instance: s.Instance, Opts: s.Opts, Time: time.Now(), Output: value})
+}
+
+func (s *Scraper) isReady() bool {
+	s.Mutex.RLock()
+	defer s.Mutex.RUnlock()
+	return s.Ready
 }
@@ -0,0 +1,204 @@
+//
+// Copyright 2016 Marios Andreopoulos
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/andmarios/sensor_exporter/sensor"
+)
+
+// TestUpdateAndMetrics scrapes sensors and stores their values, as their
+// scrape loops do, whilst /metrics is being served.
+func TestUpdateAndMetrics(t *testing.T) {
+	var test []*Scraper
+	for _, sensorType := range []string{"example", "log"} {
+		collector, err := sensor.AvailableCollectors[sensorType].New("")
+		if err != nil {
+			t.Fatal(err)
+		}
+		test = append(test, &Scraper{Type: sensorType, Instance: sensorType + "-test",
+			Collector: collector, Ready: true, Mutex: &sync.RWMutex{}})
+	}
+	scrapersMutex.Lock()
+	saved := scrapers
+	scrapers = test
+	updateSupportTexts()
+	scrapersMutex.Unlock()
+	defer func() {
+		scrapersMutex.Lock()
+		scrapers = saved
+		updateSupportTexts()
+		scrapersMutex.Unlock()
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		for _, s := range test {
+			wg.Add(1)
+			go func(s *Scraper) {
+				defer wg.Done()
+				for j := 0; j < 25; j++ {
+					value, err := s.Collector.Scrape()
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					s.update(value)
+				}
+			}(s)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 25; j++ {
+				w := httptest.NewRecorder()
+				metricsHandler(w, httptest.NewRequest("GET", "/metrics", nil))
+			}
+		}()
+	}
+	wg.Wait()
+
+	w := httptest.NewRecorder()
+	metricsHandler(w, httptest.NewRequest("GET", "/metrics", nil))
+	body := w.Body.String()
+	for _, want := range []string{
+		"# TYPE sensor_sample_random gauge\n",
+		`sensor_sample_random{instance="example-test",id=`,
+		`sensor_exporter_incidents{instance="log-test"} `,
+		`sensor_exporter_sensor_ready{sensor="example",instance="example-test"} 1` + "\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("/metrics does not contain %q:\n%s", want, body)
+		}
+	}
+}
+
+// flaky is a collector whose initialization fails as many times as
+// flakyFailures is set to.
+type flaky struct{}
+
+var flakyFailures struct {
+	sync.Mutex
+	n int
+}
+
+func (flaky) Scrape() (string, error) {
+	return "sensor_flaky 1", nil
+}
+
+func init() {
+	sensor.RegisterCollector("flaky", func(string) (sensor.Collector, error) {
+		flakyFailures.Lock()
+		defer flakyFailures.Unlock()
+		if flakyFailures.n > 0 {
+			flakyFailures.n--
+			return nil, errors.New("not yet")
+		}
+		return flaky{}, nil
+	}, time.Hour, []string{"# TYPE sensor_flaky gauge"}, []string{"# HELP sensor_flaky Always 1."}, "A test sensor.")
+}
+
+func failFlaky(n int) {
+	flakyFailures.Lock()
+	flakyFailures.n = n
+	flakyFailures.Unlock()
+}
+
+func TestResilient(t *testing.T) {
+	savedResilient, savedRetry := *resilient, *retryEvery
+	defer func() {
+		*resilient, *retryEvery = savedResilient, savedRetry
+		delete(requiredSensors, "flaky")
+		failFlaky(0)
+	}()
+	*retryEvery = 10 * time.Millisecond
+
+	// Without -resilient, a sensor that fails to initialize is an error.
+	*resilient = false
+	failFlaky(1)
+	if _, err := newScraper("flaky", 0, "", false, ""); err == nil {
+		t.Error("newScraper succeeded for a failing sensor without -resilient")
+	}
+
+	// In resilient mode, a required sensor still fails fast, whether it is
+	// required by its arguments or by -required.
+	*resilient = true
+	failFlaky(1)
+	if _, err := newScraper("flaky", 0, "", true, ""); err == nil {
+		t.Error("newScraper succeeded for a failing required sensor")
+	}
+	requiredSensors["flaky"] = true
+	failFlaky(1)
+	if _, err := processArg("flaky", false); err == nil {
+		t.Error("processArg succeeded for a failing sensor in -required")
+	}
+	delete(requiredSensors, "flaky")
+
+	// Otherwise the scraper is returned not ready, and becomes ready once
+	// a retry succeeds.
+	before := sensor.GetLabelledIncidents()[sensor.IncidentLabel{Sensor: "flaky", Reason: "not_ready"}]
+	failFlaky(2)
+	s, err := newScraper("flaky", 0, "", false, "flaky-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.isReady() {
+		t.Fatal("failing scraper is ready")
+	}
+	if got := sensor.GetLabelledIncidents()[sensor.IncidentLabel{Sensor: "flaky", Reason: "not_ready"}]; got != before+1 {
+		t.Errorf("got %d not_ready incidents, want %d", got, before+1)
+	}
+
+	scrapersMutex.Lock()
+	saved := scrapers
+	scrapers = []*Scraper{s}
+	updateSupportTexts()
+	scrapersMutex.Unlock()
+	defer func() {
+		scrapersMutex.Lock()
+		scrapers = saved
+		updateSupportTexts()
+		scrapersMutex.Unlock()
+	}()
+	metrics := func() string {
+		w := httptest.NewRecorder()
+		metricsHandler(w, httptest.NewRequest("GET", "/metrics", nil))
+		return w.Body.String()
+	}
+	ready := `sensor_exporter_sensor_ready{sensor="flaky",instance="flaky-test"} `
+	if body := metrics(); !strings.Contains(body, ready+"0\n") {
+		t.Errorf("/metrics does not report the sensor as not ready:\n%s", body)
+	}
+
+	startSensor(s)
+	defer stopSensor(s)
+	for deadline := time.Now().Add(5 * time.Second); !s.isReady(); time.Sleep(*retryEvery) {
+		if time.Now().After(deadline) {
+			t.Fatal("scraper did not become ready")
+		}
+	}
+	if body := metrics(); !strings.Contains(body, ready+"1\n") || !strings.Contains(body, `sensor_flaky{instance="flaky-test"} 1`) {
+		t.Errorf("/metrics does not report the sensor as ready:\n%s", body)
+	}
+}
@@ -18,12 +18,18 @@
 package sensor
 
 import (
+	"sync"
 	"sync/atomic"
 	"time"
 )
 
 // A Collector Every sensor must implement this interface. When called the sensor must read
 // data from its source and return a prometheus compatible values string.
+//
+// Scrape may be called concurrently, both for the same Collector and for
+// different Collectors of the same sensor type. A Collector must keep its
+// state in itself, not in package level variables, and any state that
+// changes during a scrape must be protected.
 type Collector interface {
 	Scrape() (string, error)
 }
@@ -48,6 +54,17 @@ var AvailableCollectors = make(map[string]CollectorEntry)
 
 var incidents uint64 = 0
 
+// An IncidentLabel identifies the sensor and reason of a labelled incident.
+type IncidentLabel struct {
+	Sensor string
+	Reason string
+}
+
+var labelledIncidents = struct {
+	sync.Mutex
+	m map[IncidentLabel]uint64
+}{m: make(map[IncidentLabel]uint64)}
+
 // RegisterCollector shoukd be called at the init function of each sensor
 // package to register itself to sensor_exporter. It is like golang's
 // image and image/jpg, image/gif relation.
@@ -76,3 +93,23 @@ func Incident() {
 func GetIncident() uint64 {
 	return atomic.LoadUint64(&incidents)
 }
+
+// LabelledIncident works like Incident but also records the sensor (or sink)
+// and reason of the incident, so it can be exported with labels.
+func LabelledIncident(sensor, reason string) {
+	Incident()
+	labelledIncidents.Lock()
+	labelledIncidents.m[IncidentLabel{sensor, reason}]++
+	labelledIncidents.Unlock()
+}
+
+// GetLabelledIncidents returns a copy of the labelled incidents counters.
+func GetLabelledIncidents() map[IncidentLabel]uint64 {
+	labelledIncidents.Lock()
+	defer labelledIncidents.Unlock()
+	m := make(map[IncidentLabel]uint64, len(labelledIncidents.m))
+	for k, v := range labelledIncidents.m {
+		m[k] = v
+	}
+	return m
+}
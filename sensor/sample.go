@@ -0,0 +1,228 @@
+//
+// Copyright 2016 Marios Andreopoulos
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package sensor
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// A Label is a single name="value" pair of a series.
+type Label struct {
+	Name  string
+	Value string
+}
+
+// A Sample is a single series parsed from the output of a Collector.
+type Sample struct {
+	Name   string
+	Labels []Label
+	Value  float64
+}
+
+// Label returns the value of the label with the given name, or an empty
+// string if the sample does not carry it.
+func (s Sample) Label(name string) string {
+	for _, l := range s.Labels {
+		if l.Name == name {
+			return l.Value
+		}
+	}
+	return ""
+}
+
+// SeriesLines returns the lines of a Collector's output that carry a series,
+// skipping empty lines and comments.
+func SeriesLines(out string) []string {
+	var lines []string
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// ParseSamples parses the Prometheus text format output of a Collector into
+// samples. Comments and empty lines are skipped, whilst timestamps are
+// ignored.
+func ParseSamples(out string) ([]Sample, error) {
+	var samples []Sample
+	for _, line := range SeriesLines(out) {
+		s, err := ParseSample(line)
+		if err != nil {
+			return samples, err
+		}
+		samples = append(samples, s)
+	}
+	return samples, nil
+}
+
+// ParseSample parses a single series line like:
+//
+//	cpu_temperature_celsius{sensor="Core 0"} 41.0
+func ParseSample(line string) (Sample, error) {
+	var s Sample
+	line = strings.TrimSpace(line)
+
+	i := strings.IndexAny(line, "{ \t")
+	if i <= 0 {
+		return s, errors.New("Could not parse series: " + line)
+	}
+	s.Name = line[:i]
+	rest := line[i:]
+
+	if rest[0] == '{' {
+		labels, n, err := parseLabels(rest)
+		if err != nil {
+			return s, errors.New("Could not parse labels of series: " + line + ". Err: " + err.Error())
+		}
+		s.Labels = labels
+		rest = rest[n:]
+	}
+
+	fields := strings.Fields(rest)
+	if len(fields) == 0 {
+		return s, errors.New("Series without value: " + line)
+	}
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return s, errors.New("Could not parse value of series: " + line)
+	}
+	s.Value = value
+	return s, nil
+}
+
+// parseLabels parses a label set starting with '{' and returns the labels
+// and the number of bytes consumed, including the closing '}'.
+func parseLabels(in string) ([]Label, int, error) {
+	var labels []Label
+	i := 1 // skip '{'
+	for {
+		for i < len(in) && (in[i] == ' ' || in[i] == ',') {
+			i++
+		}
+		if i >= len(in) {
+			return nil, 0, errors.New("unterminated label set")
+		}
+		if in[i] == '}' {
+			return labels, i + 1, nil
+		}
+		eq := strings.IndexByte(in[i:], '=')
+		if eq <= 0 {
+			return nil, 0, errors.New("label without value")
+		}
+		name := strings.TrimSpace(in[i : i+eq])
+		i += eq + 1
+		if i >= len(in) || in[i] != '"' {
+			return nil, 0, errors.New("label value is not quoted")
+		}
+		i++
+		var value strings.Builder
+		for ; i < len(in) && in[i] != '"'; i++ {
+			if in[i] == '\\' && i+1 < len(in) {
+				i++
+				switch in[i] {
+				case 'n':
+					value.WriteByte('\n')
+				default:
+					value.WriteByte(in[i])
+				}
+				continue
+			}
+			value.WriteByte(in[i])
+		}
+		if i >= len(in) {
+			return nil, 0, errors.New("unterminated label value")
+		}
+		i++ // skip closing '"'
+		labels = append(labels, Label{Name: name, Value: value.String()})
+	}
+}
+
+// AddLabel adds a label to every series of a Collector's output. Series that
+// already carry a label with the same name are left untouched.
+func AddLabel(out, name, value string) string {
+	if out == "" {
+		return out
+	}
+	label := name + `="` + EscapeLabelValue(value) + `"`
+	lines := strings.Split(out, "\n")
+	for k, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		i := strings.IndexAny(line, "{ \t")
+		if i <= 0 {
+			continue
+		}
+		if line[i] != '{' {
+			lines[k] = line[:i] + "{" + label + "}" + line[i:]
+			continue
+		}
+		if s, err := ParseSample(line); err == nil && s.hasLabel(name) {
+			continue
+		}
+		if strings.HasPrefix(strings.TrimSpace(line[i+1:]), "}") {
+			lines[k] = line[:i+1] + label + line[i+1:]
+		} else {
+			lines[k] = line[:i+1] + label + "," + line[i+1:]
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// EscapeLabelValue escapes a string so it can be used as a label value.
+func EscapeLabelValue(value string) string {
+	value = strings.Replace(value, `\`, `\\`, -1)
+	value = strings.Replace(value, `"`, `\"`, -1)
+	return strings.Replace(value, "\n", `\n`, -1)
+}
+
+func (s Sample) hasLabel(name string) bool {
+	for _, l := range s.Labels {
+		if l.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// String formats a sample as a Prometheus text format series line, without
+// a trailing newline.
+func (s Sample) String() string {
+	var b strings.Builder
+	b.WriteString(s.Name)
+	if len(s.Labels) > 0 {
+		b.WriteByte('{')
+		for k, l := range s.Labels {
+			if k > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(l.Name + `="` + EscapeLabelValue(l.Value) + `"`)
+		}
+		b.WriteByte('}')
+	}
+	b.WriteByte(' ')
+	b.WriteString(strconv.FormatFloat(s.Value, 'g', -1, 64))
+	return b.String()
+}
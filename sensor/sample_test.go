@@ -0,0 +1,160 @@
+//
+// Copyright 2016 Marios Andreopoulos
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package sensor
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestParseSample(t *testing.T) {
+	tests := []struct {
+		line string
+		want Sample
+	}{
+		{`cpu_temperature_celsius{sensor="Core 0"} 41.0`,
+			Sample{"cpu_temperature_celsius", []Label{{"sensor", "Core 0"}}, 41}},
+		{`up 1`, Sample{"up", nil, 1}},
+		{`up{} 1`, Sample{"up", nil, 1}},
+		{`  up   2  `, Sample{"up", nil, 2}},
+		{`m{a="1",b="2"} 3 1600000000000`,
+			Sample{"m", []Label{{"a", "1"}, {"b", "2"}}, 3}},
+		{`m{a="say \"hi\""} 1`, Sample{"m", []Label{{"a", `say "hi"`}}, 1}},
+		{`m{a="C:\\temp\\"} 1`, Sample{"m", []Label{{"a", `C:\temp\`}}, 1}},
+		{`m{a="two\nlines"} 1`, Sample{"m", []Label{{"a", "two\nlines"}}, 1}},
+		{`m{a="} {,"} 1`, Sample{"m", []Label{{"a", "} {,"}}, 1}},
+		{`m{a="1",} 1`, Sample{"m", []Label{{"a", "1"}}, 1}},
+		{`m +Inf`, Sample{"m", nil, math.Inf(1)}},
+		{`m -Inf 1600000000000`, Sample{"m", nil, math.Inf(-1)}},
+		{`m -1.5e-3`, Sample{"m", nil, -0.0015}},
+	}
+	for _, tt := range tests {
+		got, err := ParseSample(tt.line)
+		if err != nil {
+			t.Errorf("ParseSample(%q) returned error: %s", tt.line, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseSample(%q) = %#v, want %#v", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestParseSampleNaN(t *testing.T) {
+	s, err := ParseSample(`m{a="b"} NaN 1600000000000`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !math.IsNaN(s.Value) {
+		t.Errorf("value is %v, want NaN", s.Value)
+	}
+	if s.String() != `m{a="b"} NaN` {
+		t.Errorf("String() = %q", s.String())
+	}
+}
+
+func TestParseSampleErrors(t *testing.T) {
+	for _, line := range []string{
+		``,
+		`{a="b"} 1`,
+		`m`,
+		`m{a="b"}`,
+		`m{a="b"} x`,
+		`m{a="b" 1`,
+		`m{a=b} 1`,
+		`m{a} 1`,
+		`m{a="b} 1`,
+	} {
+		if s, err := ParseSample(line); err == nil {
+			t.Errorf("ParseSample(%q) = %#v, want error", line, s)
+		}
+	}
+}
+
+func TestParseSamples(t *testing.T) {
+	out := "# HELP m Help.\n# TYPE m gauge\nm{a=\"1\"} 1\n\n  \nn 2\n"
+	got, err := ParseSamples(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Sample{{"m", []Label{{"a", "1"}}, 1}, {"n", nil, 2}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseSamples() = %#v, want %#v", got, want)
+	}
+
+	got, err = ParseSamples("m 1\nbroken\nn 2\n")
+	if err == nil {
+		t.Error("ParseSamples() did not fail on a broken line")
+	}
+	if len(got) != 1 {
+		t.Errorf("ParseSamples() returned %d samples before the broken line, want 1", len(got))
+	}
+}
+
+func TestSampleStringRoundTrip(t *testing.T) {
+	for _, line := range []string{
+		`m 1`,
+		`m{a="1",b="2"} 3.5`,
+		`m{a="say \"hi\"",b="C:\\temp",c="x\ny"} -2`,
+		`m +Inf`,
+		`m -Inf`,
+	} {
+		s, err := ParseSample(line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.String() != line {
+			t.Errorf("String() = %q, want %q", s.String(), line)
+		}
+	}
+}
+
+func TestAddLabel(t *testing.T) {
+	tests := []struct {
+		out, want string
+	}{
+		{"", ""},
+		{"m 1\n", "m{instance=\"x-1\"} 1\n"},
+		{"m{} 1\n", "m{instance=\"x-1\"} 1\n"},
+		{"m{a=\"1\"} 1\n", "m{instance=\"x-1\",a=\"1\"} 1\n"},
+		{"m{instance=\"other\"} 1\n", "m{instance=\"other\"} 1\n"},
+		{"m{a=\"instance=\\\"\"} 1\n", "m{instance=\"x-1\",a=\"instance=\\\"\"} 1\n"},
+		{"# HELP m Help.\n# TYPE m gauge\nm 1 1600000000000\n",
+			"# HELP m Help.\n# TYPE m gauge\nm{instance=\"x-1\"} 1 1600000000000\n"},
+		{"m NaN\nn{b=\"} \"} +Inf\n", "m{instance=\"x-1\"} NaN\nn{instance=\"x-1\",b=\"} \"} +Inf\n"},
+	}
+	for _, tt := range tests {
+		if got := AddLabel(tt.out, "instance", "x-1"); got != tt.want {
+			t.Errorf("AddLabel(%q) = %q, want %q", tt.out, got, tt.want)
+		}
+	}
+
+	got := AddLabel("m 1\n", "path", `C:\a "b"`)
+	if want := "m{path=\"C:\\\\a \\\"b\\\"\"} 1\n"; got != want {
+		t.Errorf("AddLabel did not escape the value: %q, want %q", got, want)
+	}
+}
+
+func TestSeriesLines(t *testing.T) {
+	got := SeriesLines("# TYPE m gauge\n\nm 1\n  n 2  \n#comment\n")
+	want := []string{"m 1", "n 2"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("SeriesLines() = %#v, want %#v", got, want)
+	}
+}
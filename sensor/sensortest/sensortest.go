@@ -0,0 +1,67 @@
+//
+// Copyright 2016 Marios Andreopoulos
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+/*
+Package sensortest provides helpers for testing collectors. Collectors may be
+scraped concurrently, so their tests scrape them from several goroutines at
+once, which the race detector (go test -race) then checks.
+*/
+package sensortest
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/andmarios/sensor_exporter/sensor"
+)
+
+// Goroutines is the number of concurrent scrapes ScrapeConcurrently does.
+const Goroutines = 8
+
+// ScrapeConcurrently calls c.Scrape from Goroutines goroutines at once and
+// returns their outputs. It fails the test if any of the scrapes fails.
+func ScrapeConcurrently(t *testing.T, c sensor.Collector) []string {
+	t.Helper()
+	var wg sync.WaitGroup
+	outs := make([]string, Goroutines)
+	errs := make([]error, Goroutines)
+	for i := 0; i < Goroutines; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			outs[i], errs[i] = c.Scrape()
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Fatalf("Scrape() failed: %s", err)
+		}
+	}
+	return outs
+}
+
+// Expect scrapes c concurrently and fails the test unless every scrape
+// returns want.
+func Expect(t *testing.T, c sensor.Collector, want string) {
+	t.Helper()
+	for _, out := range ScrapeConcurrently(t, c) {
+		if out != want {
+			t.Fatalf("Scrape() =\n%s\nwant\n%s", out, want)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+//
+// Copyright 2016 Marios Andreopoulos
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package sensor
+
+import (
+	"errors"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// A Scrape is the result of a successful scrape of a Collector, as handed to
+// the sinks. Output is the Prometheus text format string that the exporter
+// exposes, after limits were applied and the instance label was added.
+// Instance labels are numbered in the order sensors are given; sinks that need
+// a name which survives a reordering can use Sensor and Opts instead.
+type Scrape struct {
+	Sensor   string
+	Instance string
+	Opts     string
+	Time     time.Time
+	Output   string
+}
+
+// Samples parses the output of the scrape.
+func (s Scrape) Samples() ([]Sample, error) {
+	return ParseSamples(s.Output)
+}
+
+// A Sink receives every completed scrape and forwards it somewhere, like a
+// push gateway or a file. Write is called from a single goroutine per sink,
+// so a Sink does not have to be safe for concurrent use. If it returns an
+// error, the exporter counts it and moves on to the next scrape.
+type Sink interface {
+	Write(s Scrape) error
+}
+
+// An AsyncSink is a Sink that also works outside Write, in a goroutine of its
+// own (e.g pushing periodically or retrying a queue). It sends the failures of
+// that work to the channel Errors returns, so the exporter can count them
+// against the sink like failed writes.
+type AsyncSink interface {
+	Sink
+	Errors() <-chan error
+}
+
+// SinkErrors is a buffered channel an AsyncSink may use for its failures.
+type SinkErrors chan error
+
+// NewSinkErrors returns a SinkErrors with room for a few errors.
+func NewSinkErrors() SinkErrors {
+	return make(SinkErrors, 16)
+}
+
+// Send sends an error without blocking. If the channel is full, because
+// nobody reads it, the error is dropped.
+func (e SinkErrors) Send(err error) {
+	select {
+	case e <- err:
+	default:
+	}
+}
+
+// A SinkEntry contains information about a Sink:
+//   - the function that creates a new Sink from its opts
+//   - a description of the Sink and its opts
+type SinkEntry struct {
+	New         func(string) (Sink, error)
+	Description string
+}
+
+// The list of available sinks
+var AvailableSinks = make(map[string]SinkEntry)
+
+// RegisterSink should be called at the init function of each sink package to
+// register itself to sensor_exporter, like RegisterCollector does for sensors.
+func RegisterSink(name string, f func(string) (Sink, error), description string) {
+	AvailableSinks[name] = SinkEntry{
+		New:         f,
+		Description: description,
+	}
+}
+
+// MetricType returns the type (gauge, counter, etc) a sensor declares for a
+// metric in its TYPE strings, or "untyped" if it does not declare one.
+func MetricType(sensorType, metric string) string {
+	for _, t := range AvailableCollectors[sensorType].Type {
+		f := strings.Fields(t)
+		if len(f) == 4 && f[2] == metric {
+			return f[3]
+		}
+	}
+	return "untyped"
+}
+
+// MetricHelp returns the HELP text a sensor declares for a metric, or an
+// empty string.
+func MetricHelp(sensorType, metric string) string {
+	prefix := "# HELP " + metric + " "
+	for _, h := range AvailableCollectors[sensorType].Help {
+		if strings.HasPrefix(h, prefix) {
+			return strings.TrimPrefix(h, prefix)
+		}
+	}
+	return ""
+}
+
+// ParseOptions parses opts in the key=value,key=value form most sinks use.
+// Values may not contain commas.
+func ParseOptions(opts string) (map[string]string, error) {
+	options := make(map[string]string)
+	for _, opt := range strings.Split(opts, ",") {
+		opt = strings.TrimSpace(opt)
+		if opt == "" {
+			continue
+		}
+		kv := strings.SplitN(opt, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, errors.New("could not understand option: " + opt)
+		}
+		options[kv[0]] = kv[1]
+	}
+	return options, nil
+}
+
+var labelName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// ExternalLabels returns the labels a sink should add to every series, read
+// from the option key in the name=value;name=value form. If the option is not
+// set, they default to host=HOSTNAME, so that series from many hosts don't
+// collide at a shared backend. If it is set but empty, no labels are added.
+func ExternalLabels(options map[string]string, key string) ([]Label, error) {
+	list, set := options[key]
+	if !set {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, errors.New("could not get hostname for the host label, set " + key + ": " + err.Error())
+		}
+		return []Label{{Name: "host", Value: hostname}}, nil
+	}
+	var labels []Label
+	for _, l := range strings.Split(list, ";") {
+		if strings.TrimSpace(l) == "" {
+			continue
+		}
+		kv := strings.SplitN(l, "=", 2)
+		if len(kv) != 2 || !labelName.MatchString(kv[0]) {
+			return nil, errors.New(key + " should be like name=value;name=value, not " + list)
+		}
+		labels = append(labels, Label{Name: kv[0], Value: kv[1]})
+	}
+	return labels, nil
+}
@@ -0,0 +1,68 @@
+//
+// Copyright 2016 Marios Andreopoulos
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package sensor
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestParseOptions(t *testing.T) {
+	got, err := ParseOptions(" url=http://host:9090/write?a=b , batch=10,,tags=")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"url": "http://host:9090/write?a=b", "batch": "10", "tags": ""}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseOptions() = %#v, want %#v", got, want)
+	}
+	for _, bad := range []string{"url", "=x", "a=1,b"} {
+		if _, err := ParseOptions(bad); err == nil {
+			t.Errorf("ParseOptions(%q) did not fail", bad)
+		}
+	}
+}
+
+func TestExternalLabels(t *testing.T) {
+	hostname, _ := os.Hostname()
+	tests := []struct {
+		options map[string]string
+		want    []Label
+	}{
+		{map[string]string{}, []Label{{"host", hostname}}},
+		{map[string]string{"tags": ""}, nil},
+		{map[string]string{"tags": "host=web1;dc=eu-1"}, []Label{{"host", "web1"}, {"dc", "eu-1"}}},
+		{map[string]string{"tags": "a=b=c;"}, []Label{{"a", "b=c"}}},
+	}
+	for _, tt := range tests {
+		got, err := ExternalLabels(tt.options, "tags")
+		if err != nil {
+			t.Errorf("ExternalLabels(%v) returned error: %s", tt.options, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ExternalLabels(%v) = %#v, want %#v", tt.options, got, tt.want)
+		}
+	}
+	for _, bad := range []string{"host", "1a=b", "a-b=c", "=b"} {
+		if _, err := ExternalLabels(map[string]string{"tags": bad}, "tags"); err == nil {
+			t.Errorf("ExternalLabels(%q) did not fail", bad)
+		}
+	}
+}
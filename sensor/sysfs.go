@@ -0,0 +1,82 @@
+//
+// Copyright 2016 Marios Andreopoulos
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package sensor
+
+import (
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Helpers for the collectors that read sysfs, where each file holds a single
+// value followed by a newline.
+
+// FileExists reports whether file exists.
+func FileExists(file string) bool {
+	_, err := os.Stat(file)
+	return err == nil
+}
+
+// ReadString returns the trimmed contents of file, or an empty string if it
+// can not be read.
+func ReadString(file string) string {
+	dat, err := ioutil.ReadFile(file)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(dat))
+}
+
+// ReadFloat parses the contents of file as a number.
+func ReadFloat(file string) (float64, error) {
+	dat, err := ioutil.ReadFile(file)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(strings.TrimSpace(string(dat)), 64)
+}
+
+// ReadDetected works like ReadFloat, for files that were found when the
+// collector was created. As such a file should stay readable, a failure is
+// logged and counted as a read_error incident of sensorType. Drivers return
+// EAGAIN or ENODATA while a value is briefly unavailable, like when a drive
+// sleeps; these failures are returned but not reported, else they would
+// raise an incident every scrape.
+func ReadDetected(sensorType, file string) (float64, error) {
+	value, err := ReadFloat(file)
+	if err != nil && !unavailable(err) {
+		LabelledIncident(sensorType, "read_error")
+		log.Printf("Sensor %s could not read %s: %s\n", sensorType, file, err.Error())
+	}
+	return value, err
+}
+
+// unavailable reports whether err means that a value can't be read for now.
+func unavailable(err error) bool {
+	return errors.Is(err, syscall.EAGAIN) || errors.Is(err, syscall.ENODATA)
+}
+
+// FormatFloat formats value for a sample line with the fewest digits that
+// represent it exactly.
+func FormatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
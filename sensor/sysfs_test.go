@@ -0,0 +1,89 @@
+//
+// Copyright 2016 Marios Andreopoulos
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package sensor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestReadFloat(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "temp1_input")
+	if err := ioutil.WriteFile(file, []byte("45500\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := ReadString(file); got != "45500" {
+		t.Errorf("ReadString() = %q, want %q", got, "45500")
+	}
+	if got := ReadString(filepath.Join(dir, "missing")); got != "" {
+		t.Errorf("ReadString() of a missing file = %q, want an empty string", got)
+	}
+	value, err := ReadFloat(file)
+	if err != nil || value != 45500 {
+		t.Errorf("ReadFloat() = %v, %v, want 45500", value, err)
+	}
+	if got := FormatFloat(value / 1000); got != "45.5" {
+		t.Errorf("FormatFloat() = %q, want %q", got, "45.5")
+	}
+	if !FileExists(file) || FileExists(filepath.Join(dir, "missing")) {
+		t.Error("FileExists() does not match the directory's contents")
+	}
+}
+
+func TestReadDetected(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "power1_input")
+	if err := ioutil.WriteFile(file, []byte("12000000\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	label := IncidentLabel{"sysfs-test", "read_error"}
+	before := GetLabelledIncidents()[label]
+	if _, err := ReadDetected("sysfs-test", file); err != nil {
+		t.Fatal(err)
+	}
+	if n := GetLabelledIncidents()[label] - before; n != 0 {
+		t.Errorf("a successful read counted %d incidents", n)
+	}
+	if _, err := ReadDetected("sysfs-test", filepath.Join(dir, "power2_input")); err == nil {
+		t.Error("ReadDetected() of a missing file did not fail")
+	}
+	if n := GetLabelledIncidents()[label] - before; n != 1 {
+		t.Errorf("a failed read counted %d incidents, want 1", n)
+	}
+}
+
+func TestUnavailable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&os.PathError{Op: "read", Path: "temp1_input", Err: syscall.EAGAIN}, true},
+		{&os.PathError{Op: "read", Path: "temp1_input", Err: syscall.ENODATA}, true},
+		{&os.PathError{Op: "open", Path: "temp1_input", Err: syscall.ENOENT}, false},
+		{&os.PathError{Op: "read", Path: "temp1_input", Err: syscall.EIO}, false},
+	}
+	for _, tt := range tests {
+		if got := unavailable(tt.err); got != tt.want {
+			t.Errorf("unavailable(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
@@ -20,10 +20,9 @@ package sensor_coretemp
 import (
 	"errors"
 	"fmt"
-	"io/ioutil"
-	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -33,50 +32,87 @@ import (
 
 var suggestedScrapeInterval = time.Duration(4800 * time.Millisecond)
 var description = `Coretemp is sensor that reads CPU temperature from the coretemp driver on
-Linux. It uses the files that the coretemp driver exposes under /sys. It does
-not take any options. To use it with the suggested scrape period:
+Linux, or the k10temp and zenpower drivers on AMD CPUs. It uses the files that
+these drivers expose under /sys. It does not need any options (a sysfs mount
+point other than /sys may be given) and may be used more than once. To use it
+with the suggested scrape period:
 
   sensor_exporter coretemp`
 
-var initialized = false
+// defaultSysfs is where sysfs is mounted, unless the opts say otherwise, as
+// they do in the tests.
+var defaultSysfs = "/sys"
 
+// cpuDrivers are the hwmon drivers that report CPU temperatures. The Intel
+// coretemp driver reports a package and per core temperatures, whilst the AMD
+// drivers report Tctl, Tdie and per CCD (Tccd1, Tccd2, …) temperatures.
+var cpuDrivers = map[string]bool{
+	"coretemp": true,
+	"k10temp":  true,
+	"zenpower": true,
+}
+
+// A Sensor keeps the sysfs files we use and the contents of the files that
+// do not change over time.
 type Sensor struct {
+	cpuSensors []cpuSensor
+}
+
+// A cpuSensor is a temperature channel of a CPU. Max, Crit and CritAlarm
+// are empty if the driver does not provide them. Labels is the label set of
+// its series.
+type cpuSensor struct {
+	Input     string
+	Max       string
+	Crit      string
+	CritAlarm string
+	Labels    string
 }
 
 func NewSensor(opts string) (sensor.Collector, error) {
-	if initialized == true {
-		return nil, errors.New("Coretemp sensor may only be used once per instance.")
+	sysfs := opts
+	if sysfs == "" {
+		sysfs = defaultSysfs
 	}
-
-	err := detectCoreTempSensors()
+	s := &Sensor{}
+	err := s.detectCoreTempSensors(sysfs)
 	if err != nil {
 		return nil, errors.New("Coretemp could not initialize sensors: " + err.Error())
 	}
 
-	numOfInputs = len(cpuTempFiles)
-	if numOfInputs == 0 {
+	if len(s.cpuSensors) == 0 {
 		return nil, errors.New("Coretemp could not find any sensors.")
 	}
 
-	s := Sensor{}
 	return s, nil
 }
 
-func (s Sensor) Scrape() (out string, e error) {
-	for k, file := range cpuTempFiles {
+func (s *Sensor) Scrape() (out string, e error) {
+	for _, c := range s.cpuSensors {
 		// Read from sysfs
-		dat, err := ioutil.ReadFile(file)
-		if err != nil {
-			return "", errors.New("Coretemp could not scrape: " + err.Error())
-		}
-		valueString := strings.TrimSuffix(string(dat), "\n")
-		value, err := strconv.ParseFloat(string(valueString), 64)
+		value, err := sensor.ReadFloat(c.Input)
 		if err != nil {
 			return "", errors.New("Coretemp could not scrape: " + err.Error())
 		}
-		value = value / 1000
 		// Write value
-		out += fmt.Sprintf("cpu_temperature_celsius{sensor=\"%s\"} %.1f\n", cpuLabel[k], value)
+		out += fmt.Sprintf("cpu_temperature_celsius{%s} %.1f\n", c.Labels, value/1000)
+
+		// Thresholds and alarms are optional, so we skip them on errors.
+		if c.Max != "" {
+			if value, err := sensor.ReadFloat(c.Max); err == nil {
+				out += fmt.Sprintf("cpu_temperature_max_celsius{%s} %.1f\n", c.Labels, value/1000)
+			}
+		}
+		if c.Crit != "" {
+			if value, err := sensor.ReadFloat(c.Crit); err == nil {
+				out += fmt.Sprintf("cpu_temperature_crit_celsius{%s} %.1f\n", c.Labels, value/1000)
+			}
+		}
+		if c.CritAlarm != "" {
+			if value, err := sensor.ReadFloat(c.CritAlarm); err == nil {
+				out += fmt.Sprintf("cpu_temperature_crit_alarm{%s} %.0f\n", c.Labels, value)
+			}
+		}
 	}
 
 	return out, nil
@@ -85,54 +121,248 @@ func (s Sensor) Scrape() (out string, e error) {
 func init() {
 	var sensorsType, sensorsHelp []string
 	sensorsType = append(sensorsType,
-		[]string{"# TYPE cpu_temperature_celsius gauge"}...)
+		[]string{"# TYPE cpu_temperature_celsius gauge",
+			"# TYPE cpu_temperature_max_celsius gauge",
+			"# TYPE cpu_temperature_crit_celsius gauge",
+			"# TYPE cpu_temperature_crit_alarm gauge"}...)
 	sensorsHelp = append(sensorsHelp,
-		[]string{"# HELP cpu_temperature_celsius Current temperature of the CPU."}...)
+		[]string{"# HELP cpu_temperature_celsius Current temperature of the CPU.",
+			"# HELP cpu_temperature_max_celsius High temperature threshold of the CPU, as set by the vendor.",
+			"# HELP cpu_temperature_crit_celsius Critical temperature of the CPU, as set by the vendor.",
+			"# HELP cpu_temperature_crit_alarm Whether the CPU is over its critical temperature (1) or not (0)."}...)
 	sensor.RegisterCollector("coretemp", NewSensor, suggestedScrapeInterval,
 		sensorsType, sensorsHelp, description)
 }
 
-// Here are stored the filenames of the sysfs files we use.
-var (
-	cpuTempFiles  []string
-	cpuLabelFiles []string
-)
+// A cpuDevice is a hwmon device of one of the cpuDrivers. Dir is where its
+// temperature files are and Device the path of the underlying device. Package
+// is the physical package (socket) it belongs to and Node, for the AMD
+// drivers, the node (die) it reads, or -1.
+type cpuDevice struct {
+	Dir     string
+	Device  string
+	Package int
+	Node    int
+}
 
-// Here are stored the contents of the files described above.
 var (
-	cpuLabel    []string
-	numOfInputs int
+	// The coretemp driver labels the package reading like "Package id 1"
+	// and names its devices after the package, like coretemp.1.
+	packageLabel   = regexp.MustCompile(`^Package id ([0-9]+)$`)
+	coretempDevice = regexp.MustCompile(`^coretemp\.([0-9]+)$`)
+	// The k10temp and zenpower drivers bind to function 3 of a node's data
+	// fabric PCI device, which is in slot 0x18 for node 0, 0x19 for node 1
+	// and so on.
+	dataFabricDevice = regexp.MustCompile(`^[0-9a-f]{4}:[0-9a-f]{2}:([0-9a-f]{2})\.3$`)
 )
 
-// detect_sensors tries to find sysfs files created from coretemp driver
-// that contain the info we seek. It then reads once the contents of files
-// that do not change over time: sensor labels
-func detectCoreTempSensors() error {
-	// Each regexp matches a sysfs file we seek.
-	inputs, _ := regexp.Compile("coretemp.*temp([0-9]+)_input")
-	labels, _ := regexp.Compile("coretemp.*temp([0-9]+)_label")
-
-	// Check populates our filename arrays with matches.
-	matchSensorFiles := func(path string, f os.FileInfo, err error) error {
-		if inputs.MatchString(path) {
-			cpuTempFiles = append(cpuTempFiles, path)
-		} else if labels.MatchString(path) {
-			cpuLabelFiles = append(cpuLabelFiles, path)
+// detectCoreTempSensors tries to find the sysfs files created from the
+// coretemp, k10temp or zenpower drivers that contain the info we seek. It then
+// reads once the contents of files that do not change over time: sensor
+// labels and CPU topology. There is one coretemp device per CPU socket, and
+// one k10temp or zenpower device per node, of which a socket may have many.
+func (s *Sensor) detectCoreTempSensors(sysfs string) error {
+	cores, err := coreCPUs(sysfs)
+	if err != nil {
+		return err
+	}
+	dies, err := diePackages(sysfs)
+	if err != nil {
+		return err
+	}
+
+	hwmons, err := filepath.Glob(filepath.Join(sysfs, "class/hwmon/hwmon*"))
+	if err != nil {
+		return err
+	}
+
+	// Older kernels keep the name and the temperature files in the
+	// device directory instead of the hwmon one.
+	devices := make(map[string][]cpuDevice)
+	for _, hwmon := range hwmons {
+		for _, dir := range []string{hwmon, filepath.Join(hwmon, "device")} {
+			name := sensor.ReadString(filepath.Join(dir, "name"))
+			if !cpuDrivers[name] {
+				continue
+			}
+			device, err := filepath.EvalSymlinks(filepath.Join(hwmon, "device"))
+			if err != nil {
+				device = hwmon
+			}
+			d := cpuDevice{Dir: dir, Device: device, Node: -1}
+			if err := d.locate(name, dies); err != nil {
+				return err
+			}
+			devices[name] = append(devices[name], d)
+			break
+		}
+	}
+
+	inputs := regexp.MustCompile("^temp([0-9]+)_input$")
+	coreLabel := regexp.MustCompile("^Core ([0-9]+)$")
+	var drivers []string
+	for name := range devices {
+		drivers = append(drivers, name)
+	}
+	sort.Strings(drivers)
+	for _, name := range drivers {
+		sort.Slice(devices[name], func(i, j int) bool {
+			a, b := devices[name][i], devices[name][j]
+			if a.Package != b.Package {
+				return a.Package < b.Package
+			}
+			return a.Node < b.Node
+		})
+		for _, d := range devices[name] {
+			files, err := filepath.Glob(filepath.Join(d.Dir, "temp*_input"))
+			if err != nil {
+				return err
+			}
+			sort.Slice(files, func(i, j int) bool {
+				return channel(inputs, files[i]) < channel(inputs, files[j])
+			})
+			for _, file := range files {
+				n := channel(inputs, file)
+				if n < 0 {
+					continue
+				}
+				// Read temperature label from /sys
+				label := sensor.ReadString(filepath.Join(d.Dir, fmt.Sprintf("temp%d_label", n)))
+				if label == "" {
+					label = fmt.Sprintf("temp%d", n)
+				}
+				c := cpuSensor{Input: file,
+					Labels: fmt.Sprintf(`sensor="%s",socket="%d"`, sensor.EscapeLabelValue(label), d.Package)}
+				if d.Node >= 0 {
+					c.Labels += fmt.Sprintf(`,node="%d"`, d.Node)
+				}
+				// The coretemp driver has a reading per physical core,
+				// which we label with the logical CPUs that share it.
+				if m := coreLabel.FindStringSubmatch(label); m != nil && name == "coretemp" {
+					if cpus, ok := cores[fmt.Sprintf("%d/%s", d.Package, m[1])]; ok {
+						c.Labels += fmt.Sprintf(`,cpus="%s"`, cpus)
+					}
+				}
+				prefix := filepath.Join(d.Dir, fmt.Sprintf("temp%d_", n))
+				if sensor.FileExists(prefix + "max") {
+					c.Max = prefix + "max"
+				}
+				if sensor.FileExists(prefix + "crit") {
+					c.Crit = prefix + "crit"
+				}
+				if sensor.FileExists(prefix + "crit_alarm") {
+					c.CritAlarm = prefix + "crit_alarm"
+				}
+				s.cpuSensors = append(s.cpuSensors, c)
+			}
+		}
+	}
+	return nil
+}
+
+// locate finds the package of a device of the name driver, and for the AMD
+// drivers its node too. The coretemp driver tells the package in its package
+// reading's label and in the name of its device. The AMD drivers read a node,
+// whose package is the one of the CPUs on that die.
+func (d *cpuDevice) locate(name string, dies map[int]int) error {
+	if name == "coretemp" {
+		labels, _ := filepath.Glob(filepath.Join(d.Dir, "temp*_label"))
+		for _, file := range labels {
+			if m := packageLabel.FindStringSubmatch(sensor.ReadString(file)); m != nil {
+				d.Package, _ = strconv.Atoi(m[1])
+				return nil
+			}
 		}
-		return nil
+		if m := coretempDevice.FindStringSubmatch(filepath.Base(d.Device)); m != nil {
+			d.Package, _ = strconv.Atoi(m[1])
+			return nil
+		}
+		return errors.New("could not find the package of " + d.Device)
+	}
+
+	m := dataFabricDevice.FindStringSubmatch(filepath.Base(d.Device))
+	if m == nil {
+		return errors.New("could not find the node of " + d.Device)
 	}
+	slot, _ := strconv.ParseInt(m[1], 16, 0)
+	d.Node = int(slot) - 0x18
+	// Without a die with this number, the CPU has a node per package.
+	d.Package = d.Node
+	if pkg, ok := dies[d.Node]; ok {
+		d.Package = pkg
+	}
+	return nil
+}
 
-	_ = filepath.Walk("/sys/devices/platform/", matchSensorFiles)
+// channel returns the channel number of a tempN_input file, or -1 if the
+// file's name does not match.
+func channel(inputs *regexp.Regexp, file string) int {
+	m := inputs.FindStringSubmatch(filepath.Base(file))
+	if m == nil {
+		return -1
+	}
+	n, _ := strconv.Atoi(m[1])
+	return n
+}
 
-	// Read temperature labels from /sys
-	for _, file := range cpuLabelFiles {
-		dat, err := ioutil.ReadFile(file)
+// coreCPUs reads the CPU topology and returns the logical CPUs that share
+// each physical core, keyed by "package/core", like "0/3": "3,7".
+func coreCPUs(sysfs string) (map[string]string, error) {
+	dirs, err := filepath.Glob(filepath.Join(sysfs, "devices/system/cpu/cpu[0-9]*/topology"))
+	if err != nil {
+		return nil, err
+	}
+	cpus := make(map[string][]int)
+	for _, dir := range dirs {
+		cpu, err := strconv.Atoi(strings.TrimPrefix(filepath.Base(filepath.Dir(dir)), "cpu"))
 		if err != nil {
-			return err
+			continue
 		}
+		pkg := sensor.ReadString(filepath.Join(dir, "physical_package_id"))
+		core := sensor.ReadString(filepath.Join(dir, "core_id"))
+		if pkg == "" || core == "" {
+			continue
+		}
+		cpus[pkg+"/"+core] = append(cpus[pkg+"/"+core], cpu)
+	}
+	cores := make(map[string]string)
+	for k, v := range cpus {
+		sort.Ints(v)
+		var list []string
+		for _, cpu := range v {
+			list = append(list, strconv.Itoa(cpu))
+		}
+		cores[k] = strings.Join(list, ",")
+	}
+	return cores, nil
+}
 
-		value := strings.TrimSuffix(string(dat), "\n")
-		cpuLabel = append(cpuLabel, value)
+// diePackages reads the CPU topology and returns the package of each die.
+// Some kernels number the dies of each package from 0, so die numbers found
+// in more than one package are left out.
+func diePackages(sysfs string) (map[int]int, error) {
+	dirs, err := filepath.Glob(filepath.Join(sysfs, "devices/system/cpu/cpu[0-9]*/topology"))
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	dies := make(map[int]int)
+	ambiguous := make(map[int]bool)
+	for _, dir := range dirs {
+		die, err := strconv.Atoi(sensor.ReadString(filepath.Join(dir, "die_id")))
+		if err != nil {
+			continue
+		}
+		pkg, err := strconv.Atoi(sensor.ReadString(filepath.Join(dir, "physical_package_id")))
+		if err != nil {
+			continue
+		}
+		if p, ok := dies[die]; ok && p != pkg {
+			ambiguous[die] = true
+		}
+		dies[die] = pkg
+	}
+	for die := range ambiguous {
+		delete(dies, die)
+	}
+	return dies, nil
 }
@@ -0,0 +1,52 @@
+//
+// Copyright 2016 Marios Andreopoulos
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package sensor_coretemp
+
+import (
+	"testing"
+
+	"github.com/andmarios/sensor_exporter/sensor/sensortest"
+)
+
+func TestScrape(t *testing.T) {
+	for _, tt := range []struct {
+		sysfs string
+		want  string
+	}{
+		// coretemp.1 has no package reading, so its package comes from
+		// the device name.
+		{"testdata/intel", `cpu_temperature_celsius{sensor="Package id 0",socket="0"} 45.0
+cpu_temperature_celsius{sensor="Core 0",socket="0",cpus="0,2"} 43.0
+cpu_temperature_max_celsius{sensor="Core 0",socket="0",cpus="0,2"} 84.0
+cpu_temperature_crit_celsius{sensor="Core 0",socket="0",cpus="0,2"} 100.0
+cpu_temperature_crit_alarm{sensor="Core 0",socket="0",cpus="0,2"} 0
+cpu_temperature_celsius{sensor="Core 1",socket="0",cpus="1"} 44.0
+cpu_temperature_celsius{sensor="Core 0",socket="1",cpus="3"} 50.0
+`},
+		// Both nodes are dies of the same socket.
+		{"testdata/amd", `cpu_temperature_celsius{sensor="Tctl",socket="0",node="0"} 50.0
+cpu_temperature_celsius{sensor="Tctl",socket="0",node="1"} 52.0
+`},
+	} {
+		s, err := NewSensor(tt.sysfs)
+		if err != nil {
+			t.Fatalf("%s: %s", tt.sysfs, err)
+		}
+		sensortest.Expect(t, s, tt.want)
+	}
+}
@@ -0,0 +1,182 @@
+//
+// Copyright 2016 Marios Andreopoulos
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+/*
+Package sensor_cpufreq reads the frequency scaling state and the thermal
+throttling counters of every CPU from /sys/devices/system/cpu.
+
+It exports the current, minimum and maximum scaling frequency and the governor
+of each logical CPU. On Intel CPUs, the kernel also counts how many times each
+core and each package got throttled because it was too hot; these are exported
+as counters, so throttling can be shown next to the CPU temperature.
+
+An opts string replaces /sys/devices/system/cpu as the directory holding
+the cpuN directories, so the tests can run against fixtures.
+*/
+package sensor_cpufreq
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/andmarios/sensor_exporter/sensor"
+)
+
+var suggestedScrapeInterval = time.Duration(4800 * time.Millisecond)
+var description = `Cpufreq reads the current, minimum and maximum scaling frequency and the
+governor of every CPU, as well as the core and package thermal throttling
+counters, from /sys/devices/system/cpu. It does not need any options. To use
+it with the suggested scrape interval:
+
+  sensor_exporter cpufreq`
+
+var defaultDir = "/sys/devices/system/cpu"
+
+var (
+	sensorsType = []string{
+		"# TYPE cpu_frequency_hertz gauge",
+		"# TYPE cpu_frequency_min_hertz gauge",
+		"# TYPE cpu_frequency_max_hertz gauge",
+		"# TYPE cpu_scaling_governor gauge",
+		"# TYPE cpu_core_throttles counter",
+		"# TYPE cpu_package_throttles counter",
+	}
+	sensorsHelp = []string{
+		"# HELP cpu_frequency_hertz Current scaling frequency of the CPU.",
+		"# HELP cpu_frequency_min_hertz Minimum scaling frequency of the CPU.",
+		"# HELP cpu_frequency_max_hertz Maximum scaling frequency of the CPU.",
+		"# HELP cpu_scaling_governor The scaling governor of the CPU, which is set to 1.",
+		"# HELP cpu_core_throttles Number of times the CPU's core was throttled because it was too hot.",
+		"# HELP cpu_package_throttles Number of times the CPU package was throttled because it was too hot.",
+	}
+)
+
+// A cpu is a logical CPU's directory and its number. Package is the physical
+// package id, or empty if the kernel does not expose the topology. Freq and
+// Throttle are set if the CPU has frequency scaling and throttling counters.
+type cpu struct {
+	Dir      string
+	Number   int
+	Package  string
+	Freq     bool
+	Throttle bool
+}
+
+type Sensor struct {
+	cpus []cpu
+}
+
+func NewSensor(opts string) (sensor.Collector, error) {
+	dir := opts
+	if dir == "" {
+		dir = defaultDir
+	}
+	s := &Sensor{}
+	if err := s.detect(dir); err != nil {
+		return nil, errors.New("Cpufreq could not initialize sensors: " + err.Error())
+	}
+	if len(s.cpus) == 0 {
+		return nil, errors.New("Cpufreq could not find any CPUs with frequency scaling or throttling counters.")
+	}
+	return s, nil
+}
+
+// Scrape reads every CPU. Files of offline CPUs can't be read; these CPUs
+// are skipped. Other read errors are reported as incidents.
+func (s *Sensor) Scrape() (out string, e error) {
+	packages := make(map[string]bool)
+	for _, c := range s.cpus {
+		if sensor.ReadString(filepath.Join(c.Dir, "online")) == "0" {
+			continue
+		}
+		labels := fmt.Sprintf(`cpu="%d"`, c.Number)
+		if c.Freq {
+			freq := filepath.Join(c.Dir, "cpufreq")
+			// Frequencies are in kHz.
+			if value, err := sensor.ReadDetected("cpufreq", filepath.Join(freq, "scaling_cur_freq")); err == nil {
+				out += fmt.Sprintf("cpu_frequency_hertz{%s} %s\n", labels, sensor.FormatFloat(value*1000))
+			}
+			if value, err := sensor.ReadDetected("cpufreq", filepath.Join(freq, "scaling_min_freq")); err == nil {
+				out += fmt.Sprintf("cpu_frequency_min_hertz{%s} %s\n", labels, sensor.FormatFloat(value*1000))
+			}
+			if value, err := sensor.ReadDetected("cpufreq", filepath.Join(freq, "scaling_max_freq")); err == nil {
+				out += fmt.Sprintf("cpu_frequency_max_hertz{%s} %s\n", labels, sensor.FormatFloat(value*1000))
+			}
+			file := filepath.Join(freq, "scaling_governor")
+			if governor := sensor.ReadString(file); governor != "" {
+				out += fmt.Sprintf("cpu_scaling_governor{%s,governor=\"%s\"} 1\n", labels, sensor.EscapeLabelValue(governor))
+			} else {
+				sensor.LabelledIncident("cpufreq", "read_error")
+				log.Printf("Sensor cpufreq could not read %s\n", file)
+			}
+		}
+
+		if !c.Throttle {
+			continue
+		}
+		throttle := filepath.Join(c.Dir, "thermal_throttle")
+		if value, err := sensor.ReadDetected("cpufreq", filepath.Join(throttle, "core_throttle_count")); err == nil {
+			out += fmt.Sprintf("cpu_core_throttles{%s} %s\n", labels, sensor.FormatFloat(value))
+		}
+		// Every CPU of a package reports the same package counter, so
+		// we export it once per package.
+		if c.Package == "" || packages[c.Package] {
+			continue
+		}
+		if value, err := sensor.ReadDetected("cpufreq", filepath.Join(throttle, "package_throttle_count")); err == nil {
+			out += fmt.Sprintf("cpu_package_throttles{package=\"%s\"} %s\n", c.Package, sensor.FormatFloat(value))
+			packages[c.Package] = true
+		}
+	}
+	return out, nil
+}
+
+// detect finds the CPUs under dir that have frequency scaling or throttling
+// counters, and reads their package id, which does not change.
+func (s *Sensor) detect(dir string) error {
+	dirs, err := filepath.Glob(filepath.Join(dir, "cpu[0-9]*"))
+	if err != nil {
+		return err
+	}
+	for _, d := range dirs {
+		n, err := strconv.Atoi(strings.TrimPrefix(filepath.Base(d), "cpu"))
+		if err != nil {
+			continue
+		}
+		c := cpu{Dir: d, Number: n,
+			Package:  sensor.EscapeLabelValue(sensor.ReadString(filepath.Join(d, "topology/physical_package_id"))),
+			Freq:     sensor.FileExists(filepath.Join(d, "cpufreq")),
+			Throttle: sensor.FileExists(filepath.Join(d, "thermal_throttle"))}
+		if !c.Freq && !c.Throttle {
+			continue
+		}
+		s.cpus = append(s.cpus, c)
+	}
+	sort.Slice(s.cpus, func(i, j int) bool { return s.cpus[i].Number < s.cpus[j].Number })
+	return nil
+}
+
+func init() {
+	sensor.RegisterCollector("cpufreq", NewSensor, suggestedScrapeInterval,
+		sensorsType, sensorsHelp, description)
+}
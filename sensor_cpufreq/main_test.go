@@ -0,0 +1,48 @@
+//
+// Copyright 2016 Marios Andreopoulos
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package sensor_cpufreq
+
+import (
+	"testing"
+
+	"github.com/andmarios/sensor_exporter/sensor"
+	"github.com/andmarios/sensor_exporter/sensor/sensortest"
+)
+
+// cpu2 is offline, so it is skipped without raising an incident.
+func TestScrape(t *testing.T) {
+	s, err := NewSensor("testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sensortest.Expect(t, s, `cpu_frequency_hertz{cpu="0"} 800000000
+cpu_frequency_min_hertz{cpu="0"} 400000000
+cpu_frequency_max_hertz{cpu="0"} 4200000000
+cpu_scaling_governor{cpu="0",governor="powersave"} 1
+cpu_core_throttles{cpu="0"} 0
+cpu_package_throttles{package="0"} 7
+cpu_frequency_hertz{cpu="1"} 900000000
+cpu_frequency_min_hertz{cpu="1"} 400000000
+cpu_frequency_max_hertz{cpu="1"} 4200000000
+cpu_scaling_governor{cpu="1",governor="powersave"} 1
+cpu_core_throttles{cpu="1"} 1
+`)
+	if n := sensor.GetLabelledIncidents()[sensor.IncidentLabel{Sensor: "cpufreq", Reason: "read_error"}]; n != 0 {
+		t.Errorf("got %d read_error incidents, want none", n)
+	}
+}
@@ -0,0 +1,122 @@
+//
+// Copyright 2016 Marios Andreopoulos
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+/*
+Package sensor_drivetemp reads hard disk temperatures from the kernel's
+drivetemp driver (Linux 5.6 and later), so the hddtemp daemon isn't needed.
+
+It finds the drivetemp hwmon devices of the disks under /sys/block and exports
+hdd_temperature_celsius with the same labels as sensor_hddtemp, so dashboards
+keep working when switching. The host label is always "localhost", like
+hddtemp's default. Note that the kernel truncates ATA disk models to 16
+characters, so the model label may be shorter than hddtemp's.
+
+Drives are found through /sys. Another mount point may be passed as opts,
+which is how the tests feed it a fake sysfs.
+*/
+package sensor_drivetemp
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/andmarios/sensor_exporter/sensor"
+)
+
+var suggestedScrapeInterval = time.Duration(4800 * time.Millisecond)
+var description = `Drivetemp reads disk temperatures from the kernel drivetemp driver, mapping
+its hwmon devices to the disks under /sys/block. It exports the same series as
+hddtemp, without the need for the hddtemp daemon. The drivetemp module must be
+loaded. It does not need any options. To use it with the suggested scrape
+interval:
+
+  sensor_exporter drivetemp`
+
+var defaultSysfs = "/sys"
+
+// A disk is a block device with a drivetemp hwmon device.
+type disk struct {
+	File   string
+	Labels string
+}
+
+type Sensor struct {
+	disks []disk
+}
+
+func NewSensor(opts string) (sensor.Collector, error) {
+	sysfs := opts
+	if sysfs == "" {
+		sysfs = defaultSysfs
+	}
+	s := &Sensor{}
+	if err := s.detect(sysfs); err != nil {
+		return nil, errors.New("Drivetemp could not initialize sensors: " + err.Error())
+	}
+	if len(s.disks) == 0 {
+		return nil, errors.New("Drivetemp could not find any disks. Is the drivetemp module loaded?")
+	}
+	return s, nil
+}
+
+// Scrape reads the temperature of every disk. Disks that fail to report one
+// (e.g because they were removed) are skipped and reported as incidents.
+func (s *Sensor) Scrape() (out string, e error) {
+	for _, d := range s.disks {
+		value, err := sensor.ReadDetected("drivetemp", d.File)
+		if err != nil {
+			continue
+		}
+		out += fmt.Sprintf("hdd_temperature_celsius{%s} %.0f\n", d.Labels, value/1000)
+	}
+	return out, nil
+}
+
+// detect finds the drivetemp hwmon devices under the block devices and reads
+// the disk models, which do not change.
+func (s *Sensor) detect(sysfs string) error {
+	hwmons, err := filepath.Glob(filepath.Join(sysfs, "block/*/device/hwmon/hwmon*"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(hwmons)
+	for _, hwmon := range hwmons {
+		if sensor.ReadString(filepath.Join(hwmon, "name")) != "drivetemp" {
+			continue
+		}
+		device := filepath.Dir(filepath.Dir(hwmon))
+		name := filepath.Base(filepath.Dir(device))
+		model := sensor.ReadString(filepath.Join(device, "model"))
+		s.disks = append(s.disks, disk{File: filepath.Join(hwmon, "temp1_input"),
+			Labels: fmt.Sprintf(`host="localhost",disk="/dev/%s",model="%s"`,
+				sensor.EscapeLabelValue(name), sensor.EscapeLabelValue(model))})
+	}
+	return nil
+}
+
+func init() {
+	var sensorsType, sensorsHelp []string
+	sensorsType = append(sensorsType,
+		[]string{"# TYPE hdd_temperature_celsius gauge"}...)
+	sensorsHelp = append(sensorsHelp,
+		[]string{"# HELP hdd_temperature_celsius Current temperature of the disk."}...)
+	sensor.RegisterCollector("drivetemp", NewSensor, suggestedScrapeInterval,
+		sensorsType, sensorsHelp, description)
+}
@@ -0,0 +1,34 @@
+//
+// Copyright 2016 Marios Andreopoulos
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package sensor_drivetemp
+
+import (
+	"testing"
+
+	"github.com/andmarios/sensor_exporter/sensor/sensortest"
+)
+
+func TestScrape(t *testing.T) {
+	s, err := NewSensor("testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sensortest.Expect(t, s, `hdd_temperature_celsius{host="localhost",disk="/dev/sda",model="WDC WD40EFRX-68N"} 35
+hdd_temperature_celsius{host="localhost",disk="/dev/sdb",model="Samsung SSD 870"} 29
+`)
+}
@@ -24,6 +24,9 @@ In general your sensor should have:
 (a) a Sensor struct (can be empty) that implements the Scrape() function.
 (b) a function with a signature like NewSensor() which creates a new sensor.
 (c) use the init() function to register itself to the main package.
+
+Scrape may be called concurrently, so keep any state in the Sensor struct and
+not in package level variables.
 */
 package sensor_example
 
@@ -0,0 +1,43 @@
+//
+// Copyright 2016 Marios Andreopoulos
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package sensor_example
+
+import (
+	"testing"
+
+	"github.com/andmarios/sensor_exporter/sensor"
+	"github.com/andmarios/sensor_exporter/sensor/sensortest"
+)
+
+func TestScrape(t *testing.T) {
+	s, err := NewSensor("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, out := range sensortest.ScrapeConcurrently(t, s) {
+		samples, err := sensor.ParseSamples(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The value is printed with one decimal, so it may be rounded to 1.
+		if len(samples) != 1 || samples[0].Name != "sensor_sample_random" ||
+			samples[0].Value < 0 || samples[0].Value > 1 {
+			t.Errorf("Scrape() = %q, want a random number in [0.0, 1.0]", out)
+		}
+	}
+}
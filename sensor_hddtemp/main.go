@@ -78,11 +78,6 @@ func NewSensor(opts string) (sensor.Collector, error) {
 	return s, nil
 }
 
-var (
-	device, model, degrees string
-	temp                   float64
-)
-
 func (s Sensor) Scrape() (out string, e error) {
 	conn, err := net.DialTimeout("tcp", s.Url, timeOut)
 	if err != nil {
@@ -92,6 +87,10 @@ func (s Sensor) Scrape() (out string, e error) {
 	}
 	defer conn.Close()
 
+	var (
+		device, model, degrees string
+		temp                   float64
+	)
 	reader, _ := bufio.NewReader(conn).ReadString('\n')
 	// We get something like: |diskA|model|temp|degree|diskB|model|temp|degree
 	// And the regexp below it breaks it to parts: |disk|model|temp|degree
@@ -0,0 +1,60 @@
+//
+// Copyright 2016 Marios Andreopoulos
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package sensor_hddtemp
+
+import (
+	"io"
+	"net"
+	"testing"
+
+	"github.com/andmarios/sensor_exporter/sensor/sensortest"
+)
+
+// A sleeping disk is skipped and Fahrenheit readings are converted.
+const reply = "|/dev/sda|WDC WD40EFRX-68N|35|C||/dev/sdb|ST4000VN008|SLP|*||/dev/sdc|Samsung SSD 870|86|F|"
+
+// serve starts a fake hddtemp daemon, which sends reply to every connection
+// and closes it, and returns its address.
+func serve(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			io.WriteString(conn, reply)
+			conn.Close()
+		}
+	}()
+	return l.Addr().String()
+}
+
+func TestScrape(t *testing.T) {
+	s, err := NewSensor(serve(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sensortest.Expect(t, s, `hdd_temperature_celsius{host="127.0.0.1",disk="/dev/sda",model="WDC WD40EFRX-68N"} 35
+hdd_temperature_celsius{host="127.0.0.1",disk="/dev/sdc",model="Samsung SSD 870"} 30
+`)
+}
@@ -0,0 +1,209 @@
+//
+// Copyright 2016 Marios Andreopoulos
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+/*
+Package sensor_hwmon reads every chip the kernel exposes under
+/sys/class/hwmon: CPU and motherboard Super-I/O chips, disks, GPUs and so on.
+
+It exports the temp, fan, in (voltage), curr, power, energy, humidity and pwm
+channels of each chip, converted to base units, with labels for the chip, the
+channel (sensor) and the channel's label, if the driver provides one.
+
+It scans /sys/class/hwmon, unless it is given another directory; the tests
+give it a fixture tree:
+
+	"hwmon,,testdata"
+*/
+package sensor_hwmon
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/andmarios/sensor_exporter/sensor"
+)
+
+var suggestedScrapeInterval = time.Duration(4800 * time.Millisecond)
+var description = `Hwmon reads every chip under /sys/class/hwmon and exports its temperature,
+fan, voltage, current, power, energy, humidity and pwm channels in base units,
+labelled by chip, sensor (channel) and label. It does not need any options.
+To use it with the suggested scrape interval:
+
+  sensor_exporter hwmon`
+
+var defaultDir = "/sys/class/hwmon"
+
+// A channelType describes how a kind of hwmon channel is exported. Dividing
+// the sysfs value by Divisor converts it to the metric's base unit.
+type channelType struct {
+	Metric  string
+	Divisor float64
+}
+
+var channelTypes = map[string]channelType{
+	"temp":     {"hwmon_temp_celsius", 1000},
+	"fan":      {"hwmon_fan_rpm", 1},
+	"in":       {"hwmon_in_volts", 1000},
+	"curr":     {"hwmon_curr_amperes", 1000},
+	"power":    {"hwmon_power_watts", 1000000},
+	"energy":   {"hwmon_energy_joules", 1000000},
+	"humidity": {"hwmon_humidity_percent", 1000},
+	"pwm":      {"hwmon_pwm_ratio", 255},
+}
+
+var (
+	sensorsType = []string{
+		"# TYPE hwmon_temp_celsius gauge",
+		"# TYPE hwmon_fan_rpm gauge",
+		"# TYPE hwmon_in_volts gauge",
+		"# TYPE hwmon_curr_amperes gauge",
+		"# TYPE hwmon_power_watts gauge",
+		"# TYPE hwmon_energy_joules counter",
+		"# TYPE hwmon_humidity_percent gauge",
+		"# TYPE hwmon_pwm_ratio gauge",
+	}
+	sensorsHelp = []string{
+		"# HELP hwmon_temp_celsius Temperature reported by a hwmon chip.",
+		"# HELP hwmon_fan_rpm Fan speed reported by a hwmon chip.",
+		"# HELP hwmon_in_volts Voltage reported by a hwmon chip.",
+		"# HELP hwmon_curr_amperes Current reported by a hwmon chip.",
+		"# HELP hwmon_power_watts Power reported by a hwmon chip.",
+		"# HELP hwmon_energy_joules Energy consumed as reported by a hwmon chip.",
+		"# HELP hwmon_humidity_percent Relative humidity reported by a hwmon chip.",
+		"# HELP hwmon_pwm_ratio PWM duty cycle of a fan output, from 0 to 1.",
+	}
+)
+
+// Matches channel files like temp1_input, power2_average or pwm1.
+var channelFile = regexp.MustCompile(`^(temp|fan|in|curr|power|energy|humidity|pwm)([0-9]+)(_input|_average)?$`)
+
+// A channel is a single reading of a chip.
+type channel struct {
+	File    string
+	Metric  string
+	Divisor float64
+	Labels  string
+}
+
+type Sensor struct {
+	channels []channel
+}
+
+func NewSensor(opts string) (sensor.Collector, error) {
+	dir := opts
+	if dir == "" {
+		dir = defaultDir
+	}
+	s := &Sensor{}
+	if err := s.detectChannels(dir); err != nil {
+		return nil, errors.New("Hwmon could not initialize sensors: " + err.Error())
+	}
+	if len(s.channels) == 0 {
+		return nil, errors.New("Hwmon could not find any sensors.")
+	}
+	return s, nil
+}
+
+// Scrape reads every channel. Some drivers return errors for channels that
+// are momentarily unavailable (e.g a sleeping device), so such channels are
+// skipped instead of failing the whole scrape, but reported as incidents.
+func (s *Sensor) Scrape() (out string, e error) {
+	for _, c := range s.channels {
+		value, err := sensor.ReadDetected("hwmon", c.File)
+		if err != nil {
+			continue
+		}
+		out += fmt.Sprintf("%s{%s} %s\n", c.Metric, c.Labels,
+			sensor.FormatFloat(value/c.Divisor))
+	}
+	return out, nil
+}
+
+// detectChannels finds the channels of every chip under dir. Channel labels
+// do not change, so they are read once here.
+func (s *Sensor) detectChannels(dir string) error {
+	chips, err := filepath.Glob(filepath.Join(dir, "hwmon*"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(chips)
+	for _, chipDir := range chips {
+		chip := chipName(chipDir)
+		files, err := ioutil.ReadDir(chipDir)
+		if err != nil {
+			continue
+		}
+		for _, f := range files {
+			m := channelFile.FindStringSubmatch(f.Name())
+			if m == nil {
+				continue
+			}
+			// Channels are read from their _input file, except pwm which
+			// has no suffix, and power which may only have _average.
+			switch {
+			case m[1] == "pwm":
+				if m[3] != "" {
+					continue
+				}
+			case m[3] == "_input":
+			case m[3] == "_average" && m[1] == "power":
+				if _, err := os.Stat(filepath.Join(chipDir, m[1]+m[2]+"_input")); err == nil {
+					continue // prefer _input
+				}
+			default:
+				continue
+			}
+			name := m[1] + m[2]
+			label := sensor.ReadString(filepath.Join(chipDir, name+"_label"))
+			t := channelTypes[m[1]]
+			s.channels = append(s.channels, channel{
+				File:    filepath.Join(chipDir, f.Name()),
+				Metric:  t.Metric,
+				Divisor: t.Divisor,
+				Labels: fmt.Sprintf(`chip="%s",sensor="%s",label="%s"`, sensor.EscapeLabelValue(chip),
+					name, sensor.EscapeLabelValue(label)),
+			})
+		}
+	}
+	return nil
+}
+
+// chipName returns a name for a chip that is stable across reboots, unlike
+// the hwmonN directory: the driver name, followed by the device it belongs
+// to if there is one, like coretemp/coretemp.0 or nvme/nvme0.
+func chipName(chipDir string) string {
+	name := sensor.ReadString(filepath.Join(chipDir, "name"))
+	if name == "" {
+		name = filepath.Base(chipDir)
+	}
+	device, err := filepath.EvalSymlinks(filepath.Join(chipDir, "device"))
+	if err != nil {
+		return name
+	}
+	return name + "/" + filepath.Base(device)
+}
+
+func init() {
+	sensor.RegisterCollector("hwmon", NewSensor, suggestedScrapeInterval,
+		sensorsType, sensorsHelp, description)
+}
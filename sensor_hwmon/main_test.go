@@ -0,0 +1,38 @@
+//
+// Copyright 2016 Marios Andreopoulos
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package sensor_hwmon
+
+import (
+	"testing"
+
+	"github.com/andmarios/sensor_exporter/sensor/sensortest"
+)
+
+func TestScrape(t *testing.T) {
+	s, err := NewSensor("testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sensortest.Expect(t, s, `hwmon_fan_rpm{chip="nct6775/nct6775.656",sensor="fan1",label=""} 1200
+hwmon_in_volts{chip="nct6775/nct6775.656",sensor="in0",label=""} 1.104
+hwmon_power_watts{chip="nct6775/nct6775.656",sensor="power1",label=""} 12.5
+hwmon_pwm_ratio{chip="nct6775/nct6775.656",sensor="pwm1",label=""} 0.5019607843137255
+hwmon_temp_celsius{chip="nct6775/nct6775.656",sensor="temp1",label="SYSTIN"} 45
+hwmon_temp_celsius{chip="acpitz",sensor="temp1",label=""} 27.8
+`)
+}
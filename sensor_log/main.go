@@ -22,8 +22,8 @@ may use it to easily detect abnormal behaviour.
 package sensor_log
 
 import (
-	"errors"
 	"fmt"
+	"sort"
 	"time"
 
 	"github.com/andmarios/sensor_exporter/sensor"
@@ -39,28 +39,41 @@ or taking too long. To use it with the suggested scrape interval:
 type Sensor struct {
 }
 
-var initialized = false
-
 func NewSensor(opts string) (sensor.Collector, error) {
-	if initialized == true {
-		return nil, errors.New("Only one log sensor may be set.")
-	}
-	initialized = true
 	s := Sensor{}
 	return s, nil
 }
 
 func (s Sensor) Scrape() (out string, e error) {
 	out += fmt.Sprintf("sensor_exporter_incidents %d\n", sensor.GetIncident())
+
+	// Sort labelled incidents so our output is stable between scrapes.
+	incidents := sensor.GetLabelledIncidents()
+	var keys []sensor.IncidentLabel
+	for k := range incidents {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Sensor != keys[j].Sensor {
+			return keys[i].Sensor < keys[j].Sensor
+		}
+		return keys[i].Reason < keys[j].Reason
+	})
+	for _, k := range keys {
+		out += fmt.Sprintf("sensor_exporter_labelled_incidents{sensor=\"%s\",reason=\"%s\"} %d\n",
+			k.Sensor, k.Reason, incidents[k])
+	}
 	return out, nil
 }
 
 func init() {
 	var sensorsType, sensorsHelp []string
 	sensorsType = append(sensorsType,
-		[]string{"# TYPE sensor_exporter_incidents counter"}...)
+		[]string{"# TYPE sensor_exporter_incidents counter",
+			"# TYPE sensor_exporter_labelled_incidents counter"}...)
 	sensorsHelp = append(sensorsHelp,
-		[]string{"# HELP sensor_exporter_incidents Counter of serious incidents for sensor_exporter that an admin should investigate."}...)
+		[]string{"# HELP sensor_exporter_incidents Counter of serious incidents for sensor_exporter that an admin should investigate.",
+			"# HELP sensor_exporter_labelled_incidents Counter of incidents that carry the sensor (or sink) and reason that caused them."}...)
 	sensor.RegisterCollector("log", NewSensor, suggestedScrapeInterval,
 		sensorsType, sensorsHelp, description)
 }
@@ -0,0 +1,38 @@
+//
+// Copyright 2016 Marios Andreopoulos
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package sensor_log
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/andmarios/sensor_exporter/sensor"
+	"github.com/andmarios/sensor_exporter/sensor/sensortest"
+)
+
+func TestScrape(t *testing.T) {
+	s, err := NewSensor("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sensor.LabelledIncident("example", "test")
+	label := sensor.IncidentLabel{Sensor: "example", Reason: "test"}
+	sensortest.Expect(t, s, fmt.Sprintf(`sensor_exporter_incidents %d
+sensor_exporter_labelled_incidents{sensor="example",reason="test"} %d
+`, sensor.GetIncident(), sensor.GetLabelledIncidents()[label]))
+}
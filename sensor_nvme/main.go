@@ -0,0 +1,233 @@
+//
+// Copyright 2016 Marios Andreopoulos
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+/*
+Package sensor_nvme reads NVMe drive information and temperatures from
+/sys/class/nvme, which hddtemp never supported.
+
+For every controller it exports an info series with its model, serial number
+and firmware revision, and the temperatures of its hwmon device: the composite
+temperature and, if the drive has them, the individual sensors, along with
+their min, max and critical thresholds and the alarm. Every series is labelled
+with the controller (nvme0). A namespace info series maps each namespace
+(nvme0n1) to its controller. Drives report thresholds they don't have as
+absolute zero; these are left out.
+
+Controllers are read from /sys/class/nvme; the tests pass their own
+directory as opts.
+*/
+package sensor_nvme
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/andmarios/sensor_exporter/sensor"
+)
+
+var suggestedScrapeInterval = time.Duration(4800 * time.Millisecond)
+var description = `Nvme reads the model, serial number and firmware revision of NVMe drives
+from /sys/class/nvme, and their composite and per sensor temperatures with
+their thresholds from the drives' hwmon devices. It does not need any
+options. To use it with the suggested scrape interval:
+
+  sensor_exporter nvme`
+
+var defaultDir = "/sys/class/nvme"
+
+var (
+	sensorsType = []string{
+		"# TYPE nvme_info gauge",
+		"# TYPE nvme_namespace_info gauge",
+		"# TYPE nvme_temperature_celsius gauge",
+		"# TYPE nvme_temperature_min_celsius gauge",
+		"# TYPE nvme_temperature_max_celsius gauge",
+		"# TYPE nvme_temperature_crit_celsius gauge",
+		"# TYPE nvme_temperature_alarm gauge",
+	}
+	sensorsHelp = []string{
+		"# HELP nvme_info Model, serial number and firmware revision of the NVMe controller.",
+		"# HELP nvme_namespace_info A namespace of the NVMe controller.",
+		"# HELP nvme_temperature_celsius Current temperature of the NVMe drive.",
+		"# HELP nvme_temperature_min_celsius Low temperature threshold of the NVMe drive.",
+		"# HELP nvme_temperature_max_celsius High temperature threshold of the NVMe drive.",
+		"# HELP nvme_temperature_crit_celsius Critical temperature of the NVMe drive.",
+		"# HELP nvme_temperature_alarm Whether the temperature is outside its thresholds (1) or not (0).",
+	}
+)
+
+var controllerDir = regexp.MustCompile(`^nvme[0-9]+$`)
+var tempInput = regexp.MustCompile(`^temp([0-9]+)_input$`)
+
+// thresholds are the files we export along with each temperature, the
+// metric they are exported as and the divisor that converts them to it.
+var thresholds = []threshold{
+	{"min", "nvme_temperature_min_celsius", 1000},
+	{"max", "nvme_temperature_max_celsius", 1000},
+	{"crit", "nvme_temperature_crit_celsius", 1000},
+	{"alarm", "nvme_temperature_alarm", 1},
+}
+
+type threshold struct {
+	Suffix  string
+	Metric  string
+	Divisor float64
+}
+
+// absoluteZero is what drives report, in millidegrees, for thresholds they
+// don't have.
+const absoluteZero = -273150
+
+// A controller is an NVMe controller, with the labels of its series and its
+// temperature channels.
+type controller struct {
+	Info       string
+	Namespaces []string
+	Channels   []channel
+}
+
+// A channel is a temperature of the controller's hwmon device. Prefix is
+// the path of its files, like .../hwmon1/temp1_, which we add the suffixes
+// to. Thresholds are those the drive supports.
+type channel struct {
+	Prefix     string
+	Labels     string
+	Thresholds []threshold
+}
+
+type Sensor struct {
+	controllers []controller
+}
+
+func NewSensor(opts string) (sensor.Collector, error) {
+	dir := opts
+	if dir == "" {
+		dir = defaultDir
+	}
+	s := &Sensor{}
+	if err := s.detect(dir); err != nil {
+		return nil, errors.New("Nvme could not initialize sensors: " + err.Error())
+	}
+	if len(s.controllers) == 0 {
+		return nil, errors.New("Nvme could not find any NVMe controllers.")
+	}
+	return s, nil
+}
+
+// Scrape reads the temperatures of every controller. Files that fail to be
+// read (e.g because the drive was removed) are skipped and reported as
+// incidents.
+func (s *Sensor) Scrape() (out string, e error) {
+	for _, c := range s.controllers {
+		out += fmt.Sprintf("nvme_info{%s} 1\n", c.Info)
+		for _, ns := range c.Namespaces {
+			out += fmt.Sprintf("nvme_namespace_info{%s} 1\n", ns)
+		}
+		for _, ch := range c.Channels {
+			value, err := sensor.ReadDetected("nvme", ch.Prefix+"input")
+			if err != nil {
+				continue
+			}
+			out += fmt.Sprintf("nvme_temperature_celsius{%s} %s\n", ch.Labels, sensor.FormatFloat(value/1000))
+			for _, t := range ch.Thresholds {
+				if value, err := sensor.ReadDetected("nvme", ch.Prefix+t.Suffix); err == nil && value > absoluteZero {
+					out += fmt.Sprintf("%s{%s} %s\n", t.Metric, ch.Labels, sensor.FormatFloat(value/t.Divisor))
+				}
+			}
+		}
+	}
+	return out, nil
+}
+
+// detect finds the NVMe controllers under dir and reads the files that do
+// not change over time: their identity, namespaces, channel labels and the
+// thresholds each channel supports.
+func (s *Sensor) detect(dir string) error {
+	dirs, err := filepath.Glob(filepath.Join(dir, "nvme*"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(dirs)
+	for _, d := range dirs {
+		name := filepath.Base(d)
+		if !controllerDir.MatchString(name) {
+			continue
+		}
+		// Namespaces are named like nvme0n1, or nvme0c0n1 with multipath.
+		namespaces, _ := filepath.Glob(filepath.Join(d, name+"*n[0-9]*"))
+		for k := range namespaces {
+			namespaces[k] = filepath.Base(namespaces[k])
+		}
+		sort.Strings(namespaces)
+		labels := fmt.Sprintf(`controller="%s"`, name)
+
+		c := controller{Info: fmt.Sprintf(`%s,model="%s",serial="%s",firmware="%s"`, labels,
+			sensor.EscapeLabelValue(sensor.ReadString(filepath.Join(d, "model"))),
+			sensor.EscapeLabelValue(sensor.ReadString(filepath.Join(d, "serial"))),
+			sensor.EscapeLabelValue(sensor.ReadString(filepath.Join(d, "firmware_rev"))))}
+		for _, ns := range namespaces {
+			c.Namespaces = append(c.Namespaces, fmt.Sprintf(`%s,namespace="%s"`, labels, ns))
+		}
+
+		// The hwmon device belongs to the controller on recent kernels and
+		// to its PCI device on older ones.
+		hwmons, _ := filepath.Glob(filepath.Join(d, "hwmon*"))
+		if len(hwmons) == 0 {
+			hwmons, _ = filepath.Glob(filepath.Join(d, "device/hwmon/hwmon*"))
+		}
+		for _, hwmon := range hwmons {
+			files, _ := ioutil.ReadDir(hwmon)
+			var numbers []int
+			for _, f := range files {
+				if m := tempInput.FindStringSubmatch(f.Name()); m != nil {
+					n, _ := strconv.Atoi(m[1])
+					numbers = append(numbers, n)
+				}
+			}
+			sort.Ints(numbers)
+			for _, n := range numbers {
+				prefix := filepath.Join(hwmon, fmt.Sprintf("temp%d_", n))
+				label := sensor.ReadString(prefix + "label")
+				if label == "" {
+					label = fmt.Sprintf("temp%d", n)
+				}
+				ch := channel{Prefix: prefix,
+					Labels: fmt.Sprintf(`%s,sensor="%s"`, labels, sensor.EscapeLabelValue(label))}
+				// Thresholds the drive does not support can't be read.
+				for _, t := range thresholds {
+					if _, err := sensor.ReadFloat(prefix + t.Suffix); err == nil {
+						ch.Thresholds = append(ch.Thresholds, t)
+					}
+				}
+				c.Channels = append(c.Channels, ch)
+			}
+		}
+		s.controllers = append(s.controllers, c)
+	}
+	return nil
+}
+
+func init() {
+	sensor.RegisterCollector("nvme", NewSensor, suggestedScrapeInterval,
+		sensorsType, sensorsHelp, description)
+}
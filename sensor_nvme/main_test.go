@@ -0,0 +1,43 @@
+//
+// Copyright 2016 Marios Andreopoulos
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package sensor_nvme
+
+import (
+	"testing"
+
+	"github.com/andmarios/sensor_exporter/sensor/sensortest"
+)
+
+// Sensor 1 has no thresholds, so only its temperature is exported. The min
+// threshold of the composite temperature is absolute zero, which means the
+// drive does not have one.
+func TestScrape(t *testing.T) {
+	s, err := NewSensor("testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sensortest.Expect(t, s, `nvme_info{controller="nvme0",model="Samsung SSD 980 PRO 1TB",serial="S5GXNX0R123456",firmware="5B2QGXA7"} 1
+nvme_namespace_info{controller="nvme0",namespace="nvme0n1"} 1
+nvme_namespace_info{controller="nvme0",namespace="nvme0n2"} 1
+nvme_temperature_celsius{controller="nvme0",sensor="Composite"} 38.85
+nvme_temperature_max_celsius{controller="nvme0",sensor="Composite"} 81.85
+nvme_temperature_crit_celsius{controller="nvme0",sensor="Composite"} 84.85
+nvme_temperature_alarm{controller="nvme0",sensor="Composite"} 0
+nvme_temperature_celsius{controller="nvme0",sensor="Sensor 1"} 40.85
+`)
+}
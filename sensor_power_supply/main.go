@@ -0,0 +1,211 @@
+//
+// Copyright 2016 Marios Andreopoulos
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+/*
+Package sensor_power_supply reads batteries, AC adapters and other power
+supplies from /sys/class/power_supply, as found on laptops and on single board
+computers with a UPS hat.
+
+For every supply it exports whichever of these the driver provides: online,
+status, capacity, energy and charge (now, full, full design), voltage, current,
+power and cycle count, converted to base units where there is one. Supplies
+are looked up on every scrape, so batteries and adapters that are plugged in or
+removed later come and go with them.
+
+Its option is the power_supply class directory, which is only useful for
+testing:
+
+	"power_supply,,/sys/class/power_supply"
+*/
+package sensor_power_supply
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/andmarios/sensor_exporter/sensor"
+)
+
+var suggestedScrapeInterval = time.Duration(9600 * time.Millisecond)
+var description = `Power_supply reads batteries and AC adapters from /sys/class/power_supply,
+exporting charge state, battery health and power draw, labelled by supply name
+and type. It does not need any options. To use it with the suggested scrape
+interval:
+
+  sensor_exporter power_supply`
+
+var defaultDir = "/sys/class/power_supply"
+
+// An attribute is a sysfs file of a power supply that we export. Dividing
+// the sysfs value by Divisor converts it to the metric's unit.
+type attribute struct {
+	File    string
+	Metric  string
+	Divisor float64
+}
+
+// Energy is reported in µWh and charge in µAh. We keep these units rather
+// than joules and coulombs, as batteries are rated in them.
+var attributes = []attribute{
+	{"online", "power_supply_online", 1},
+	{"capacity", "power_supply_capacity_percent", 1},
+	{"energy_now", "power_supply_energy_watthours", 1000000},
+	{"energy_full", "power_supply_energy_full_watthours", 1000000},
+	{"energy_full_design", "power_supply_energy_full_design_watthours", 1000000},
+	{"charge_now", "power_supply_charge_amperehours", 1000000},
+	{"charge_full", "power_supply_charge_full_amperehours", 1000000},
+	{"charge_full_design", "power_supply_charge_full_design_amperehours", 1000000},
+	{"voltage_now", "power_supply_voltage_volts", 1000000},
+	{"current_now", "power_supply_current_amperes", 1000000},
+	{"power_now", "power_supply_power_watts", 1000000},
+	{"cycle_count", "power_supply_cycle_count", 1},
+}
+
+// statuses are the values of the status file. We export all of them, with
+// the current one set to 1, so that each has a series of its own.
+var statuses = []string{"Unknown", "Charging", "Discharging", "Not charging", "Full"}
+
+var (
+	sensorsType = []string{
+		"# TYPE power_supply_online gauge",
+		"# TYPE power_supply_status gauge",
+		"# TYPE power_supply_capacity_percent gauge",
+		"# TYPE power_supply_energy_watthours gauge",
+		"# TYPE power_supply_energy_full_watthours gauge",
+		"# TYPE power_supply_energy_full_design_watthours gauge",
+		"# TYPE power_supply_charge_amperehours gauge",
+		"# TYPE power_supply_charge_full_amperehours gauge",
+		"# TYPE power_supply_charge_full_design_amperehours gauge",
+		"# TYPE power_supply_voltage_volts gauge",
+		"# TYPE power_supply_current_amperes gauge",
+		"# TYPE power_supply_power_watts gauge",
+		"# TYPE power_supply_cycle_count gauge",
+	}
+	sensorsHelp = []string{
+		"# HELP power_supply_online Whether the supply (e.g an AC adapter) is connected (1) or not (0).",
+		"# HELP power_supply_status Whether the battery is in this status (1) or not (0).",
+		"# HELP power_supply_capacity_percent Charge of the battery as a percentage of its full charge.",
+		"# HELP power_supply_energy_watthours Energy stored in the battery.",
+		"# HELP power_supply_energy_full_watthours Energy stored in the battery when full.",
+		"# HELP power_supply_energy_full_design_watthours Energy the battery was designed to store when full.",
+		"# HELP power_supply_charge_amperehours Charge stored in the battery.",
+		"# HELP power_supply_charge_full_amperehours Charge stored in the battery when full.",
+		"# HELP power_supply_charge_full_design_amperehours Charge the battery was designed to store when full.",
+		"# HELP power_supply_voltage_volts Current voltage of the supply.",
+		"# HELP power_supply_current_amperes Current flowing from or to the supply.",
+		"# HELP power_supply_power_watts Current power drawn from or to the supply.",
+		"# HELP power_supply_cycle_count Number of charge cycles of the battery.",
+	}
+)
+
+// A supply is a power supply directory, the attributes it provides and the
+// labels of its series.
+type supply struct {
+	Dir        string
+	Labels     string
+	Attributes []attribute
+	Status     bool
+}
+
+type Sensor struct {
+	dir string
+}
+
+func NewSensor(opts string) (sensor.Collector, error) {
+	s := &Sensor{dir: opts}
+	if s.dir == "" {
+		s.dir = defaultDir
+	}
+	supplies, err := s.detect()
+	if err != nil {
+		return nil, errors.New("Power_supply could not initialize sensors: " + err.Error())
+	}
+	if len(supplies) == 0 {
+		return nil, errors.New("Power_supply could not find any power supplies.")
+	}
+	return s, nil
+}
+
+// Scrape detects the supplies and reads them. Some drivers return errors for
+// attributes that are temporarily unavailable; these are skipped and reported
+// as incidents.
+func (s *Sensor) Scrape() (out string, e error) {
+	supplies, err := s.detect()
+	if err != nil {
+		return "", err
+	}
+	for _, p := range supplies {
+		for _, a := range p.Attributes {
+			if value, err := sensor.ReadDetected("power_supply", filepath.Join(p.Dir, a.File)); err == nil {
+				out += fmt.Sprintf("%s{%s} %s\n", a.Metric, p.Labels, sensor.FormatFloat(value/a.Divisor))
+			}
+		}
+		if p.Status {
+			file := filepath.Join(p.Dir, "status")
+			status := sensor.ReadString(file)
+			if status == "" {
+				sensor.LabelledIncident("power_supply", "read_error")
+				log.Printf("Sensor power_supply could not read %s\n", file)
+				continue
+			}
+			for _, st := range statuses {
+				value := 0
+				if st == status {
+					value = 1
+				}
+				out += fmt.Sprintf("power_supply_status{%s,status=\"%s\"} %d\n", p.Labels, st, value)
+			}
+		}
+	}
+	return out, nil
+}
+
+// detect finds the power supplies under the sensor's directory, the
+// attributes each of them provides and their type.
+func (s *Sensor) detect() ([]supply, error) {
+	dirs, err := filepath.Glob(filepath.Join(s.dir, "*"))
+	if err != nil {
+		return nil, err
+	}
+	var supplies []supply
+	sort.Strings(dirs)
+	for _, supplyDir := range dirs {
+		supplyType := sensor.ReadString(filepath.Join(supplyDir, "type"))
+		if supplyType == "" {
+			continue
+		}
+		p := supply{Dir: supplyDir, Labels: fmt.Sprintf(`supply="%s",type="%s"`,
+			sensor.EscapeLabelValue(filepath.Base(supplyDir)), sensor.EscapeLabelValue(supplyType))}
+		for _, a := range attributes {
+			if sensor.FileExists(filepath.Join(supplyDir, a.File)) {
+				p.Attributes = append(p.Attributes, a)
+			}
+		}
+		p.Status = sensor.FileExists(filepath.Join(supplyDir, "status"))
+		supplies = append(supplies, p)
+	}
+	return supplies, nil
+}
+
+func init() {
+	sensor.RegisterCollector("power_supply", NewSensor, suggestedScrapeInterval,
+		sensorsType, sensorsHelp, description)
+}
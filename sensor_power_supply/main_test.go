@@ -0,0 +1,103 @@
+//
+// Copyright 2016 Marios Andreopoulos
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package sensor_power_supply
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/andmarios/sensor_exporter/sensor"
+	"github.com/andmarios/sensor_exporter/sensor/sensortest"
+)
+
+func TestScrape(t *testing.T) {
+	s, err := NewSensor("testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sensortest.Expect(t, s, `power_supply_online{supply="AC",type="Mains"} 0
+power_supply_capacity_percent{supply="BAT0",type="Battery"} 80
+power_supply_energy_watthours{supply="BAT0",type="Battery"} 40
+power_supply_energy_full_watthours{supply="BAT0",type="Battery"} 50
+power_supply_energy_full_design_watthours{supply="BAT0",type="Battery"} 57
+power_supply_voltage_volts{supply="BAT0",type="Battery"} 12
+power_supply_power_watts{supply="BAT0",type="Battery"} 9.5
+power_supply_cycle_count{supply="BAT0",type="Battery"} 42
+power_supply_status{supply="BAT0",type="Battery",status="Unknown"} 0
+power_supply_status{supply="BAT0",type="Battery",status="Charging"} 0
+power_supply_status{supply="BAT0",type="Battery",status="Discharging"} 1
+power_supply_status{supply="BAT0",type="Battery",status="Not charging"} 0
+power_supply_status{supply="BAT0",type="Battery",status="Full"} 0
+`)
+}
+
+// copyDir copies the regular files of a testdata tree, so a test can change
+// them.
+func copyDir(t *testing.T, src, dst string) {
+	err := filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, strings.TrimPrefix(path, src))
+		if info.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		dat, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(target, dat, 0644)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHotplug(t *testing.T) {
+	dir := t.TempDir()
+	copyDir(t, "testdata", dir)
+	s, err := NewSensor(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	readErrors := sensor.IncidentLabel{Sensor: "power_supply", Reason: "read_error"}
+	before := sensor.GetLabelledIncidents()[readErrors]
+
+	// A second battery is plugged in and the first one removed.
+	copyDir(t, "testdata/BAT0", filepath.Join(dir, "BAT1"))
+	ioutil.WriteFile(filepath.Join(dir, "BAT1", "capacity"), []byte("30\n"), 0644)
+	if err := os.RemoveAll(filepath.Join(dir, "BAT0")); err != nil {
+		t.Fatal(err)
+	}
+	out, err := s.Scrape()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out, `supply="BAT0"`) {
+		t.Errorf("removed battery is still exported:\n%s", out)
+	}
+	if !strings.Contains(out, `power_supply_capacity_percent{supply="BAT1",type="Battery"} 30`+"\n") {
+		t.Errorf("new battery is not exported:\n%s", out)
+	}
+	if got := sensor.GetLabelledIncidents()[readErrors] - before; got != 0 {
+		t.Errorf("removing a battery raised %d read errors", got)
+	}
+}
@@ -0,0 +1,220 @@
+//
+// Copyright 2016 Marios Andreopoulos
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+/*
+Package sensor_rapl reads the energy counters of Intel's (and recent AMD's)
+Running Average Power Limit interface, from /sys/class/powercap. There is a
+zone for each CPU package, with subzones for its cores, uncore (e.g the
+integrated GPU) and DRAM, depending on the CPU.
+
+The kernel's energy_uj counters wrap around at max_energy_range_uj. The sensor
+keeps its own total per zone, so that it exports counters that only go up, as
+long as it is scraped at least once per wraparound, which takes minutes even at
+full load. It also exports the zones' power limit constraints.
+
+Since Linux 5.10 energy_uj is readable only by root, so sensor_exporter has to
+run as root (or be granted access to the files) to use this sensor.
+
+Users need not set any opts. The tests set the powercap directory to read
+from, since reading the real one needs root and an Intel or AMD CPU.
+*/
+package sensor_rapl
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/andmarios/sensor_exporter/sensor"
+)
+
+var suggestedScrapeInterval = time.Duration(4800 * time.Millisecond)
+var description = `Rapl reads the RAPL energy counters of the CPU packages and their core,
+uncore and DRAM domains from /sys/class/powercap, handling their wraparound,
+and exports them as joule counters along with their power limits. It needs
+read access to energy_uj, which is root only on recent kernels. It does not
+need any options. To use it with the suggested scrape interval:
+
+  sensor_exporter rapl`
+
+var defaultDir = "/sys/class/powercap"
+
+var (
+	sensorsType = []string{
+		"# TYPE rapl_energy_joules counter",
+		"# TYPE rapl_power_limit_watts gauge",
+		"# TYPE rapl_power_limit_time_window_seconds gauge",
+		"# TYPE rapl_zone_enabled gauge",
+	}
+	sensorsHelp = []string{
+		"# HELP rapl_energy_joules Energy consumed by the RAPL zone, corrected for counter wraparound.",
+		"# HELP rapl_power_limit_watts Power limit of a RAPL zone's constraint.",
+		"# HELP rapl_power_limit_time_window_seconds Time window over which a RAPL zone's power limit applies.",
+		"# HELP rapl_zone_enabled Whether power limiting is enabled (1) or not (0) for the RAPL zone.",
+	}
+)
+
+// Zones are named like intel-rapl:0 (a package) or intel-rapl:0:1 (one of
+// its subzones). There are also intel-rapl-mmio zones on some CPUs.
+var zoneDir = regexp.MustCompile(`^intel-rapl(-mmio)?(:[0-9]+)+$`)
+
+var constraintName = regexp.MustCompile(`^constraint_([0-9]+)_name$`)
+
+// A zone is a RAPL zone and the state we need to handle the wraparound of
+// its counter.
+type zone struct {
+	Dir         string
+	Labels      string
+	MaxRange    float64
+	Enabled     bool
+	Constraints []constraint
+
+	last  float64
+	total float64
+	seen  bool
+}
+
+// A constraint's TimeWindow is false if it has no time window (e.g the
+// peak_power constraint).
+type constraint struct {
+	Prefix     string
+	Labels     string
+	TimeWindow bool
+}
+
+type Sensor struct {
+	zones []*zone
+	mutex sync.Mutex
+}
+
+func NewSensor(opts string) (sensor.Collector, error) {
+	dir := opts
+	if dir == "" {
+		dir = defaultDir
+	}
+	s := &Sensor{}
+	if err := s.detect(dir); err != nil {
+		return nil, errors.New("Rapl could not initialize sensors: " + err.Error())
+	}
+	if len(s.zones) == 0 {
+		return nil, errors.New("Rapl could not find any RAPL zones.")
+	}
+	// Read the counters once, so the first scrape has a baseline and we
+	// fail early if we can't read them.
+	for _, z := range s.zones {
+		raw, err := sensor.ReadFloat(filepath.Join(z.Dir, "energy_uj"))
+		if err != nil {
+			return nil, errors.New("Rapl could not read energy counter: " + err.Error())
+		}
+		z.update(raw)
+	}
+	return s, nil
+}
+
+func (s *Sensor) Scrape() (out string, e error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, z := range s.zones {
+		raw, err := sensor.ReadFloat(filepath.Join(z.Dir, "energy_uj"))
+		if err != nil {
+			return "", errors.New("Rapl could not scrape: " + err.Error())
+		}
+		z.update(raw)
+		out += fmt.Sprintf("rapl_energy_joules{%s} %s\n", z.Labels, sensor.FormatFloat(z.total/1000000))
+
+		if z.Enabled {
+			if value, err := sensor.ReadDetected("rapl", filepath.Join(z.Dir, "enabled")); err == nil {
+				out += fmt.Sprintf("rapl_zone_enabled{%s} %s\n", z.Labels, sensor.FormatFloat(value))
+			}
+		}
+		for _, c := range z.Constraints {
+			if value, err := sensor.ReadDetected("rapl", c.Prefix+"power_limit_uw"); err == nil {
+				out += fmt.Sprintf("rapl_power_limit_watts{%s} %s\n", c.Labels, sensor.FormatFloat(value/1000000))
+			}
+			if c.TimeWindow {
+				if value, err := sensor.ReadDetected("rapl", c.Prefix+"time_window_us"); err == nil {
+					out += fmt.Sprintf("rapl_power_limit_time_window_seconds{%s} %s\n", c.Labels, sensor.FormatFloat(value/1000000))
+				}
+			}
+		}
+	}
+	return out, nil
+}
+
+// update adds the energy consumed since the last reading to the zone's
+// total. If the counter went backwards, it wrapped around at MaxRange.
+func (z *zone) update(raw float64) {
+	if !z.seen {
+		z.last, z.total, z.seen = raw, raw, true
+		return
+	}
+	delta := raw - z.last
+	if delta < 0 {
+		delta += z.MaxRange
+	}
+	z.total += delta
+	z.last = raw
+}
+
+// detect finds the RAPL zones under dir and reads the files that do not
+// change over time: names, counter ranges and constraint names. It also
+// notes which of the optional files each zone and constraint provides.
+func (s *Sensor) detect(dir string) error {
+	dirs, err := filepath.Glob(filepath.Join(dir, "intel-rapl*"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(dirs)
+	for _, d := range dirs {
+		if !zoneDir.MatchString(filepath.Base(d)) {
+			continue
+		}
+		maxRange, err := sensor.ReadFloat(filepath.Join(d, "max_energy_range_uj"))
+		if err != nil {
+			return err
+		}
+		z := &zone{Dir: d, MaxRange: maxRange, Enabled: sensor.FileExists(filepath.Join(d, "enabled")),
+			Labels: fmt.Sprintf(`zone="%s",name="%s"`, filepath.Base(d),
+				sensor.EscapeLabelValue(sensor.ReadString(filepath.Join(d, "name"))))}
+
+		files, _ := ioutil.ReadDir(d)
+		for _, f := range files {
+			m := constraintName.FindStringSubmatch(f.Name())
+			if m == nil {
+				continue
+			}
+			name := sensor.ReadString(filepath.Join(d, f.Name()))
+			prefix := filepath.Join(d, "constraint_"+m[1]+"_")
+			z.Constraints = append(z.Constraints, constraint{Prefix: prefix,
+				Labels:     fmt.Sprintf(`%s,constraint="%s"`, z.Labels, sensor.EscapeLabelValue(name)),
+				TimeWindow: sensor.FileExists(prefix + "time_window_us")})
+		}
+		s.zones = append(s.zones, z)
+	}
+	return nil
+}
+
+func init() {
+	sensor.RegisterCollector("rapl", NewSensor, suggestedScrapeInterval,
+		sensorsType, sensorsHelp, description)
+}
@@ -0,0 +1,55 @@
+//
+// Copyright 2016 Marios Andreopoulos
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package sensor_rapl
+
+import (
+	"testing"
+
+	"github.com/andmarios/sensor_exporter/sensor/sensortest"
+)
+
+func TestScrape(t *testing.T) {
+	s, err := NewSensor("testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sensortest.Expect(t, s, `rapl_energy_joules{zone="intel-rapl:0",name="package-0"} 1
+rapl_zone_enabled{zone="intel-rapl:0",name="package-0"} 1
+rapl_power_limit_watts{zone="intel-rapl:0",name="package-0",constraint="long_term"} 65
+rapl_power_limit_time_window_seconds{zone="intel-rapl:0",name="package-0",constraint="long_term"} 27.983872
+rapl_power_limit_watts{zone="intel-rapl:0",name="package-0",constraint="peak_power"} 200
+rapl_energy_joules{zone="intel-rapl:0:0",name="core"} 0.5
+`)
+}
+
+func TestUpdate(t *testing.T) {
+	z := &zone{MaxRange: 1000}
+	for _, tt := range []struct {
+		raw, total float64
+	}{
+		{900, 900}, // the first reading is the baseline
+		{950, 950},
+		{50, 1050}, // the counter wrapped around
+		{60, 1060},
+	} {
+		z.update(tt.raw)
+		if z.total != tt.total {
+			t.Errorf("update(%v): total = %v, want %v", tt.raw, z.total, tt.total)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+//
+// Copyright 2016 Marios Andreopoulos
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+/*
+Package sensor_thermal reads the kernel's thermal zones and cooling devices
+from /sys/class/thermal. These exist on most ARM boards (e.g the Raspberry Pi)
+and laptops, even where there is no coretemp driver.
+
+For every thermal zone it exports its temperature and trip points, and for
+every cooling device (fans, CPU frequency scaling, etc) its current and
+maximum cooling state.
+
+The zones and devices are looked up in /sys/class/thermal, or in the
+directory passed as opts, like "thermal,,testdata" in the tests.
+*/
+package sensor_thermal
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/andmarios/sensor_exporter/sensor"
+)
+
+var suggestedScrapeInterval = time.Duration(4800 * time.Millisecond)
+var description = `Thermal reads thermal zones (temperature, trip points) and cooling devices
+(current and maximum state) from /sys/class/thermal. It works on ARM boards
+like the Raspberry Pi as well as on Intel/AMD systems. It does not need any
+options. To use it with the suggested scrape interval:
+
+  sensor_exporter thermal`
+
+var defaultDir = "/sys/class/thermal"
+
+var (
+	sensorsType = []string{
+		"# TYPE thermal_zone_temperature_celsius gauge",
+		"# TYPE thermal_zone_trip_point_celsius gauge",
+		"# TYPE thermal_cooling_device_cur_state gauge",
+		"# TYPE thermal_cooling_device_max_state gauge",
+	}
+	sensorsHelp = []string{
+		"# HELP thermal_zone_temperature_celsius Current temperature of a thermal zone.",
+		"# HELP thermal_zone_trip_point_celsius Temperature of a thermal zone's trip point.",
+		"# HELP thermal_cooling_device_cur_state Current cooling state of a cooling device.",
+		"# HELP thermal_cooling_device_max_state Maximum cooling state of a cooling device.",
+	}
+)
+
+var tripPointTemp = regexp.MustCompile(`^trip_point_([0-9]+)_temp$`)
+
+// A zone's Temp, like a cooling device's CurState and MaxState, is empty if
+// it could not be read at startup (e.g the zone is disabled).
+type zone struct {
+	Temp   string
+	Labels string
+	Trips  []trip
+}
+
+type trip struct {
+	File   string
+	Labels string
+}
+
+type coolingDevice struct {
+	CurState string
+	MaxState string
+	Labels   string
+}
+
+type Sensor struct {
+	zones   []zone
+	devices []coolingDevice
+}
+
+func NewSensor(opts string) (sensor.Collector, error) {
+	dir := opts
+	if dir == "" {
+		dir = defaultDir
+	}
+	s := &Sensor{}
+	if err := s.detect(dir); err != nil {
+		return nil, errors.New("Thermal could not initialize sensors: " + err.Error())
+	}
+	if len(s.zones) == 0 && len(s.devices) == 0 {
+		return nil, errors.New("Thermal could not find any thermal zones or cooling devices.")
+	}
+	return s, nil
+}
+
+// Scrape reads every zone and cooling device. Files that were readable at
+// startup but fail now are skipped and reported as incidents.
+func (s *Sensor) Scrape() (out string, e error) {
+	for _, z := range s.zones {
+		if z.Temp != "" {
+			if value, err := sensor.ReadDetected("thermal", z.Temp); err == nil {
+				out += fmt.Sprintf("thermal_zone_temperature_celsius{%s} %s\n", z.Labels, sensor.FormatFloat(value/1000))
+			}
+		}
+		for _, t := range z.Trips {
+			if value, err := sensor.ReadDetected("thermal", t.File); err == nil {
+				out += fmt.Sprintf("thermal_zone_trip_point_celsius{%s} %s\n", t.Labels, sensor.FormatFloat(value/1000))
+			}
+		}
+	}
+	for _, d := range s.devices {
+		if d.CurState != "" {
+			if value, err := sensor.ReadDetected("thermal", d.CurState); err == nil {
+				out += fmt.Sprintf("thermal_cooling_device_cur_state{%s} %s\n", d.Labels, sensor.FormatFloat(value))
+			}
+		}
+		if d.MaxState != "" {
+			if value, err := sensor.ReadDetected("thermal", d.MaxState); err == nil {
+				out += fmt.Sprintf("thermal_cooling_device_max_state{%s} %s\n", d.Labels, sensor.FormatFloat(value))
+			}
+		}
+	}
+	return out, nil
+}
+
+// detect finds the thermal zones and cooling devices under dir and reads
+// their types, which do not change. Disabled zones and devices return errors
+// when read, so only the files that can be read now are kept.
+func (s *Sensor) detect(dir string) error {
+	zones, err := filepath.Glob(filepath.Join(dir, "thermal_zone*"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(zones)
+	for _, zoneDir := range zones {
+		name := filepath.Base(zoneDir)
+		z := zone{Temp: readable(filepath.Join(zoneDir, "temp")), Labels: fmt.Sprintf(`zone="%s",type="%s"`, name,
+			sensor.EscapeLabelValue(sensor.ReadString(filepath.Join(zoneDir, "type"))))}
+
+		files, _ := ioutil.ReadDir(zoneDir)
+		for _, f := range files {
+			m := tripPointTemp.FindStringSubmatch(f.Name())
+			if m == nil {
+				continue
+			}
+			file := readable(filepath.Join(zoneDir, f.Name()))
+			if file == "" {
+				continue
+			}
+			tripType := sensor.ReadString(filepath.Join(zoneDir, "trip_point_"+m[1]+"_type"))
+			z.Trips = append(z.Trips, trip{File: file,
+				Labels: fmt.Sprintf(`%s,trip="%s",trip_type="%s"`, z.Labels, m[1], sensor.EscapeLabelValue(tripType))})
+		}
+		sort.Slice(z.Trips, func(i, j int) bool { return tripIndex(z.Trips[i].File) < tripIndex(z.Trips[j].File) })
+		s.zones = append(s.zones, z)
+	}
+
+	devices, err := filepath.Glob(filepath.Join(dir, "cooling_device*"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(devices)
+	for _, deviceDir := range devices {
+		s.devices = append(s.devices, coolingDevice{
+			CurState: readable(filepath.Join(deviceDir, "cur_state")),
+			MaxState: readable(filepath.Join(deviceDir, "max_state")),
+			Labels: fmt.Sprintf(`device="%s",type="%s"`, filepath.Base(deviceDir),
+				sensor.EscapeLabelValue(sensor.ReadString(filepath.Join(deviceDir, "type"))))})
+	}
+	return nil
+}
+
+// readable returns file if it can be read, or an empty string if not.
+func readable(file string) string {
+	if _, err := sensor.ReadFloat(file); err != nil {
+		return ""
+	}
+	return file
+}
+
+func tripIndex(file string) int {
+	m := tripPointTemp.FindStringSubmatch(filepath.Base(file))
+	n, _ := strconv.Atoi(m[1])
+	return n
+}
+
+func init() {
+	sensor.RegisterCollector("thermal", NewSensor, suggestedScrapeInterval,
+		sensorsType, sensorsHelp, description)
+}
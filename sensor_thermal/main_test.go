@@ -0,0 +1,38 @@
+//
+// Copyright 2016 Marios Andreopoulos
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package sensor_thermal
+
+import (
+	"testing"
+
+	"github.com/andmarios/sensor_exporter/sensor/sensortest"
+)
+
+// thermal_zone1 has no temperature, like a disabled zone, so it is skipped.
+func TestScrape(t *testing.T) {
+	s, err := NewSensor("testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sensortest.Expect(t, s, `thermal_zone_temperature_celsius{zone="thermal_zone0",type="x86_pkg_temp"} 52
+thermal_zone_trip_point_celsius{zone="thermal_zone0",type="x86_pkg_temp",trip="0",trip_type="passive"} 90
+thermal_zone_trip_point_celsius{zone="thermal_zone0",type="x86_pkg_temp",trip="1",trip_type="critical"} 100
+thermal_cooling_device_cur_state{device="cooling_device0",type="Processor"} 0
+thermal_cooling_device_max_state{device="cooling_device0",type="Processor"} 3
+`)
+}
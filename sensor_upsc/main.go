@@ -146,7 +146,7 @@ func (s Sensor) Scrape() (out string, e error) {
 		return "", nil
 	}
 	defer conn.Close()
-	fmt.Fprintf(conn, "LIST VAR "+s.Ups+"\n")
+	fmt.Fprintf(conn, "LIST VAR %s\n", s.Ups)
 	reader := bufio.NewReader(conn)
 
 	res, err := reader.ReadString('\n')
@@ -0,0 +1,71 @@
+//
+// Copyright 2016 Marios Andreopoulos
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package sensor_upsc
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/andmarios/sensor_exporter/sensor/sensortest"
+)
+
+// serve starts a fake upsd, which answers LIST VAR for the UPS named ups,
+// and returns its address.
+func serve(t *testing.T, ups string) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				line, err := bufio.NewReader(conn).ReadString('\n')
+				if err != nil || line != "LIST VAR "+ups+"\n" {
+					io.WriteString(conn, "ERR UNKNOWN-UPS\n")
+					return
+				}
+				io.WriteString(conn, "BEGIN LIST VAR "+ups+"\n"+
+					"VAR "+ups+" battery.charge \"100\"\n"+
+					"VAR "+ups+" device.mfr \"EATON\"\n"+
+					"VAR "+ups+" input.voltage \"230.5\"\n"+
+					"VAR "+ups+" ups.load \"14\"\n"+
+					"END LIST VAR "+ups+"\n")
+			}(conn)
+		}
+	}()
+	return l.Addr().String()
+}
+
+func TestScrape(t *testing.T) {
+	s, err := NewSensor("MYUPS@" + serve(t, "MYUPS"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sensortest.Expect(t, s, `upsc_battery_charge{ups="MYUPS",host="127.0.0.1"} 100.00
+upsc_input_voltage{ups="MYUPS",host="127.0.0.1"} 230.50
+upsc_ups_load{ups="MYUPS",host="127.0.0.1"} 14.00
+`)
+}
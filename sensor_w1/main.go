@@ -0,0 +1,185 @@
+//
+// Copyright 2016 Marios Andreopoulos
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+/*
+Package sensor_w1 reads DS18B20 temperature probes on a 1-Wire bus (e.g the
+w1-gpio bus of a Raspberry Pi) from /sys/bus/w1/devices.
+
+Every probe's w1_slave file has two lines, like:
+
+	72 01 4b 46 7f ff 0e 10 57 : crc=57 YES
+	72 01 4b 46 7f ff 0e 10 57 t=23125
+
+Readings that fail the CRC check (no YES), or that are the 85°C power-on reset
+value of a probe that did not complete a conversion, are discarded and raise
+an incident.
+
+Its options map probe ids to friendly names, which are exported as the name
+label. Probes without a friendly name use their id as name. A dir option,
+used by the tests, overrides /sys/bus/w1/devices:
+
+	"w1,,28-0316a2794aff=rack_inlet,28-0316a27ab1ff=rack_outlet"
+*/
+package sensor_w1
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/andmarios/sensor_exporter/sensor"
+)
+
+var suggestedScrapeInterval = time.Duration(9600 * time.Millisecond)
+var description = `W1 reads DS18B20 temperature probes on a 1-Wire bus from /sys/bus/w1/devices,
+discarding readings with a bad CRC or the 85°C power-on reset value. Its opts
+map probe ids to friendly names, exported as the name label. Each probe takes
+up to 750ms to read, hence the longer suggested scrape interval. Example:
+
+  sensor_exporter w1,,28-0316a2794aff=rack_inlet,28-0316a27ab1ff=rack_outlet`
+
+var defaultDir = "/sys/bus/w1/devices"
+
+// powerOnReset is the value, in millidegrees, a DS18B20 returns if it did
+// not complete a temperature conversion, e.g because it lost power.
+const powerOnReset = 85000
+
+type Sensor struct {
+	dir   string
+	names map[string]string
+}
+
+func NewSensor(opts string) (sensor.Collector, error) {
+	options, err := sensor.ParseOptions(opts)
+	if err != nil {
+		return nil, errors.New("W1 could not parse options: " + err.Error())
+	}
+	s := &Sensor{dir: defaultDir, names: make(map[string]string)}
+	for k, v := range options {
+		if k == "dir" {
+			s.dir = v
+			continue
+		}
+		s.names[k] = v
+	}
+
+	probes, err := s.probes()
+	if err != nil {
+		return nil, errors.New("W1 could not initialize sensors: " + err.Error())
+	}
+	if len(probes) == 0 {
+		return nil, errors.New("W1 could not find any DS18B20 probes. Is the w1-therm module loaded?")
+	}
+	for id := range s.names {
+		if !contains(probes, id) {
+			log.Printf("W1: probe %s has a friendly name but was not found on the bus.\n", id)
+		}
+	}
+	return s, nil
+}
+
+// Scrape reads every probe on the bus. We look for probes on every scrape,
+// since probes may be added to or removed from the bus at any time.
+func (s *Sensor) Scrape() (out string, e error) {
+	probes, err := s.probes()
+	if err != nil {
+		return "", errors.New("W1 could not scrape: " + err.Error())
+	}
+	for _, id := range probes {
+		dat, err := ioutil.ReadFile(filepath.Join(s.dir, id, "w1_slave"))
+		if err != nil {
+			// The probe was removed whilst we were reading it.
+			continue
+		}
+		value, err := parse(string(dat))
+		if err != nil {
+			sensor.LabelledIncident("w1", "bad_reading")
+			log.Printf("W1: discarding reading of probe %s: %s\n", id, err.Error())
+			continue
+		}
+		name := id
+		if n, ok := s.names[id]; ok {
+			name = n
+		}
+		out += fmt.Sprintf("w1_temperature_celsius{device=\"%s\",name=\"%s\"} %s\n",
+			id, sensor.EscapeLabelValue(name), sensor.FormatFloat(value/1000))
+	}
+	return out, nil
+}
+
+// parse checks the CRC line of a w1_slave file and returns the temperature
+// in millidegrees from its second line.
+func parse(dat string) (float64, error) {
+	lines := strings.Split(strings.TrimSpace(dat), "\n")
+	if len(lines) < 2 {
+		return 0, errors.New("short read")
+	}
+	if !strings.HasSuffix(strings.TrimSpace(lines[0]), "YES") {
+		return 0, errors.New("CRC check failed")
+	}
+	i := strings.Index(lines[1], "t=")
+	if i < 0 {
+		return 0, errors.New("no temperature")
+	}
+	value, err := strconv.ParseFloat(strings.TrimSpace(lines[1][i+2:]), 64)
+	if err != nil {
+		return 0, err
+	}
+	if value == powerOnReset {
+		return 0, errors.New("power-on reset value")
+	}
+	return value, nil
+}
+
+// probes returns the ids of the DS18B20 probes, whose family code is 28.
+func (s *Sensor) probes() ([]string, error) {
+	dirs, err := filepath.Glob(filepath.Join(s.dir, "28-*"))
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, d := range dirs {
+		ids = append(ids, filepath.Base(d))
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func init() {
+	var sensorsType, sensorsHelp []string
+	sensorsType = append(sensorsType,
+		[]string{"# TYPE w1_temperature_celsius gauge"}...)
+	sensorsHelp = append(sensorsHelp,
+		[]string{"# HELP w1_temperature_celsius Current temperature of a 1-Wire DS18B20 probe."}...)
+	sensor.RegisterCollector("w1", NewSensor, suggestedScrapeInterval,
+		sensorsType, sensorsHelp, description)
+}
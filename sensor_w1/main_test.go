@@ -0,0 +1,36 @@
+//
+// Copyright 2016 Marios Andreopoulos
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package sensor_w1
+
+import (
+	"testing"
+
+	"github.com/andmarios/sensor_exporter/sensor/sensortest"
+)
+
+// Probe 28-0316a27cd2ff fails its CRC check and 28-0316a27e01ff reads the
+// power-on reset value with a good CRC, so their readings are discarded.
+func TestScrape(t *testing.T) {
+	s, err := NewSensor("dir=testdata,28-0316a2794aff=rack_inlet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sensortest.Expect(t, s, `w1_temperature_celsius{device="28-0316a2794aff",name="rack_inlet"} 23.125
+w1_temperature_celsius{device="28-0316a27ab1ff",name="28-0316a27ab1ff"} 25
+`)
+}
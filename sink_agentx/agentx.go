@@ -0,0 +1,299 @@
+//
+// Copyright 2016 Marios Andreopoulos
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package sink_agentx
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// The little of the AgentX protocol a read only subagent needs.
+// See <https://www.rfc-editor.org/rfc/rfc2741>.
+
+// PDU types
+const (
+	pduOpen       = 1
+	pduClose      = 2
+	pduRegister   = 3
+	pduGet        = 5
+	pduGetNext    = 6
+	pduGetBulk    = 7
+	pduTestSet    = 8
+	pduCommitSet  = 9
+	pduUndoSet    = 10
+	pduCleanupSet = 11
+	pduResponse   = 18
+)
+
+// Header flags
+const (
+	flagNonDefaultContext = 0x08
+	flagNetworkByteOrder  = 0x10
+)
+
+// Varbind types
+const (
+	typeInteger        = 2
+	typeOctetString    = 4
+	typeNoSuchObject   = 128
+	typeNoSuchInstance = 129
+	typeEndOfMibView   = 130
+)
+
+// Response errors
+const (
+	errorNotWritable = 17
+	errorProcessing  = 268
+)
+
+const headerLength = 20
+
+type oid []uint32
+
+func parseOid(s string) (oid, error) {
+	var o oid
+	for _, part := range strings.Split(strings.Trim(s, "."), ".") {
+		n, err := strconv.ParseUint(part, 10, 32)
+		if err != nil {
+			return nil, errors.New("bad OID: " + s)
+		}
+		o = append(o, uint32(n))
+	}
+	return o, nil
+}
+
+func (o oid) String() string {
+	var parts []string
+	for _, n := range o {
+		parts = append(parts, strconv.FormatUint(uint64(n), 10))
+	}
+	return strings.Join(parts, ".")
+}
+
+// compare returns -1, 0 or 1 if o is less than, equal to or greater than p
+// in lexicographic order.
+func (o oid) compare(p oid) int {
+	for i := 0; i < len(o) && i < len(p); i++ {
+		if o[i] < p[i] {
+			return -1
+		}
+		if o[i] > p[i] {
+			return 1
+		}
+	}
+	switch {
+	case len(o) < len(p):
+		return -1
+	case len(o) > len(p):
+		return 1
+	}
+	return 0
+}
+
+// hasPrefix reports whether p is a prefix of o.
+func (o oid) hasPrefix(p oid) bool {
+	return len(o) >= len(p) && o[:len(p)].compare(p) == 0
+}
+
+// A header is the common header of every PDU.
+type header struct {
+	Type          byte
+	Flags         byte
+	SessionID     uint32
+	TransactionID uint32
+	PacketID      uint32
+	PayloadLength uint32
+}
+
+func (h header) order() binary.ByteOrder {
+	if h.Flags&flagNetworkByteOrder != 0 {
+		return binary.BigEndian
+	}
+	return binary.LittleEndian
+}
+
+func readPDU(r io.Reader) (header, []byte, error) {
+	var h header
+	buf := make([]byte, headerLength)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return h, nil, err
+	}
+	if buf[0] != 1 {
+		return h, nil, errors.New("unsupported AgentX version")
+	}
+	h.Type, h.Flags = buf[1], buf[2]
+	order := h.order()
+	h.SessionID = order.Uint32(buf[4:])
+	h.TransactionID = order.Uint32(buf[8:])
+	h.PacketID = order.Uint32(buf[12:])
+	h.PayloadLength = order.Uint32(buf[16:])
+	if h.PayloadLength > 1<<20 {
+		return h, nil, errors.New("PDU too large")
+	}
+	payload := make([]byte, h.PayloadLength)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return h, nil, err
+	}
+	return h, payload, nil
+}
+
+// An encoder builds PDUs. We always send in network byte order.
+type encoder struct {
+	b []byte
+}
+
+func (e *encoder) uint16(v uint16) {
+	e.b = append(e.b, byte(v>>8), byte(v))
+}
+
+func (e *encoder) uint32(v uint32) {
+	e.b = append(e.b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func (e *encoder) oid(o oid, include bool) {
+	var inc byte
+	if include {
+		inc = 1
+	}
+	e.b = append(e.b, byte(len(o)), 0, inc, 0)
+	for _, n := range o {
+		e.uint32(n)
+	}
+}
+
+func (e *encoder) octetString(s string) {
+	e.uint32(uint32(len(s)))
+	e.b = append(e.b, s...)
+	for len(e.b)%4 != 0 {
+		e.b = append(e.b, 0)
+	}
+}
+
+func (e *encoder) varbind(v varbind) {
+	e.uint16(v.Type)
+	e.uint16(0)
+	e.oid(v.Name, false)
+	switch v.Type {
+	case typeInteger:
+		e.uint32(uint32(v.Integer))
+	case typeOctetString:
+		e.octetString(v.String)
+	}
+}
+
+// pdu prepends a header to a payload.
+func pdu(pduType byte, flags byte, sessionID, transactionID, packetID uint32, payload []byte) []byte {
+	e := &encoder{}
+	e.b = append(e.b, 1, pduType, flags|flagNetworkByteOrder, 0)
+	e.uint32(sessionID)
+	e.uint32(transactionID)
+	e.uint32(packetID)
+	e.uint32(uint32(len(payload)))
+	return append(e.b, payload...)
+}
+
+// A decoder reads the payload of a PDU.
+type decoder struct {
+	b     []byte
+	order binary.ByteOrder
+	err   error
+}
+
+func (d *decoder) need(n int) bool {
+	if d.err != nil {
+		return false
+	}
+	if len(d.b) < n {
+		d.err = errors.New("short PDU")
+		return false
+	}
+	return true
+}
+
+func (d *decoder) uint16() uint16 {
+	if !d.need(2) {
+		return 0
+	}
+	v := d.order.Uint16(d.b)
+	d.b = d.b[2:]
+	return v
+}
+
+func (d *decoder) uint32() uint32 {
+	if !d.need(4) {
+		return 0
+	}
+	v := d.order.Uint32(d.b)
+	d.b = d.b[4:]
+	return v
+}
+
+func (d *decoder) oid() (oid, bool) {
+	if !d.need(4) {
+		return nil, false
+	}
+	n, prefix, include := int(d.b[0]), d.b[1], d.b[2] != 0
+	d.b = d.b[4:]
+	var o oid
+	if prefix != 0 { // Short for 1.3.6.1.prefix
+		o = oid{1, 3, 6, 1, uint32(prefix)}
+	}
+	for i := 0; i < n; i++ {
+		o = append(o, d.uint32())
+	}
+	return o, include
+}
+
+func (d *decoder) octetString() string {
+	n := int(d.uint32())
+	padded := (n + 3) &^ 3
+	if !d.need(padded) {
+		return ""
+	}
+	s := string(d.b[:n])
+	d.b = d.b[padded:]
+	return s
+}
+
+// A searchRange is a start and end OID of a Get, GetNext or GetBulk request.
+type searchRange struct {
+	Start   oid
+	Include bool
+	End     oid
+}
+
+func (d *decoder) searchRanges() []searchRange {
+	var ranges []searchRange
+	for len(d.b) > 0 && d.err == nil {
+		var r searchRange
+		r.Start, r.Include = d.oid()
+		r.End, _ = d.oid()
+		ranges = append(ranges, r)
+	}
+	return ranges
+}
+
+type varbind struct {
+	Type    uint16
+	Name    oid
+	Integer int32
+	String  string
+}
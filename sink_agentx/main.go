@@ -0,0 +1,407 @@
+//
+// Copyright 2016 Marios Andreopoulos
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+/*
+Package sink_agentx makes sensor_exporter an AgentX subagent of a local SNMP
+master agent, like net-snmp's snmpd (with "master agentx" in snmpd.conf), so
+SNMP pollers can read every series.
+
+Series are published as a table under a configurable OID subtree:
+
+	OID.1        sensorTable
+	OID.1.1      sensorEntry, indexed by the series key
+	OID.1.1.1.X  sensorInstance  OCTET STRING  sensor instance, like coretemp-1
+	OID.1.1.2.X  sensorMetric    OCTET STRING  metric name
+	OID.1.1.3.X  sensorLabels    OCTET STRING  labels, like sensor="Core 0"
+	OID.1.1.4.X  sensorValue     OCTET STRING  value as a decimal string
+	OID.1.1.5.X  sensorMilli     Integer32     value multiplied by 1000
+
+The index X of a series is its key (INSTANCE/METRIC{LABELS}) encoded as an
+OID string index (length followed by the characters), so it stays the same
+between scrapes and restarts.
+
+Its opts are comma separated key=value pairs:
+
+	address  the master agent, unix:PATH or tcp:HOST:PORT (default unix:/var/agentx/master)
+	oid      the subtree to register, at most 28 sub-identifiers (default 1.3.6.1.4.1.8072.9999.9999.1)
+*/
+package sink_agentx
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andmarios/sensor_exporter/sensor"
+)
+
+var description = `Agentx makes sensor_exporter an AgentX subagent of a local SNMP master agent,
+publishing every series in a table (instance, metric, labels, value, value*1000)
+under an OID subtree, indexed by the series' key. Its opts are comma separated
+key=value pairs: address (unix:PATH or tcp:HOST:PORT, default
+unix:/var/agentx/master) and oid (default 1.3.6.1.4.1.8072.9999.9999.1).
+Example:
+
+  sensor_exporter -sink agentx,,oid=1.3.6.1.4.1.8072.9999.9999.1 coretemp hddtemp upsc,,MYUPS`
+
+var (
+	defaultAddress = "unix:/var/agentx/master"
+	// NET-SNMP-MIB::netSnmpPlaypen, meant for experimental use.
+	defaultOid    = "1.3.6.1.4.1.8072.9999.9999.1"
+	timeOut       = 5 * time.Second
+	retryInterval = 10 * time.Second
+	// OIDs may have at most 128 sub-identifiers, keep indexes well below.
+	maxOidLength   = 128
+	maxIndexLength = 96
+)
+
+// Table columns
+const (
+	columnInstance = 1
+	columnMetric   = 2
+	columnLabels   = 3
+	columnValue    = 4
+	columnMilli    = 5
+	columns        = 5
+)
+
+type Sink struct {
+	Network string
+	Address string
+	Root    oid
+	mutex   sync.Mutex
+	latest  map[string][]sensor.Sample
+	table   []varbind // sorted by OID, built on demand
+	dirty   bool
+	errors  sensor.SinkErrors
+}
+
+func NewSink(opts string) (sensor.Sink, error) {
+	options, err := sensor.ParseOptions(opts)
+	if err != nil {
+		return nil, errors.New("Agentx " + err.Error())
+	}
+	address := options["address"]
+	if address == "" {
+		address = defaultAddress
+	}
+	conf := strings.SplitN(address, ":", 2)
+	if len(conf) != 2 || (conf[0] != "unix" && conf[0] != "tcp") {
+		return nil, errors.New("Agentx address should be unix:PATH or tcp:HOST:PORT, not " + address)
+	}
+	s := &Sink{Network: conf[0], Address: conf[1], latest: make(map[string][]sensor.Sample),
+		errors: sensor.NewSinkErrors()}
+	if options["oid"] == "" {
+		options["oid"] = defaultOid
+	}
+	s.Root, err = parseOid(options["oid"])
+	if err != nil {
+		return nil, errors.New("Agentx " + err.Error())
+	}
+	// Our objects are OID.1.1.COLUMN.LENGTH.INDEX, they must fit in an OID.
+	if len(s.Root)+4+maxIndexLength > maxOidLength {
+		return nil, fmt.Errorf("Agentx oid %s is too long, it may have at most %d sub-identifiers", s.Root, maxOidLength-4-maxIndexLength)
+	}
+
+	go s.run()
+	return s, nil
+}
+
+// Write keeps the latest samples of each instance for the master's requests.
+func (s *Sink) Write(scrape sensor.Scrape) error {
+	samples, err := scrape.Samples()
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	s.latest[scrape.Instance] = samples
+	s.dirty = true
+	s.mutex.Unlock()
+	return nil
+}
+
+// run keeps a session with the master agent open, reconnecting when needed.
+// Only the first failure of an outage is reported as an error, the attempts
+// to reconnect that follow are only logged.
+func (s *Sink) run() {
+	down := false
+	for {
+		registered, err := s.session()
+		if registered {
+			down = false
+		}
+		err = fmt.Errorf("Agentx session with %s:%s ended, retrying in %s: %s", s.Network, s.Address, retryInterval, err)
+		if down {
+			log.Printf("%s\n", err)
+		} else {
+			s.errors.Send(err)
+			down = true
+		}
+		time.Sleep(retryInterval)
+	}
+}
+
+// Errors returns the failures of the session with the master agent.
+func (s *Sink) Errors() <-chan error {
+	return s.errors
+}
+
+// session opens a session with the master agent, registers our subtree and
+// answers the master's requests until the session ends. It reports whether
+// registration succeeded.
+func (s *Sink) session() (bool, error) {
+	conn, err := net.DialTimeout(s.Network, s.Address, timeOut)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	// Open a session, then register our subtree.
+	e := &encoder{}
+	e.b = append(e.b, byte(timeOut/time.Second), 0, 0, 0)
+	e.oid(nil, false)
+	e.octetString("sensor_exporter")
+	conn.SetDeadline(time.Now().Add(timeOut))
+	if _, err := conn.Write(pdu(pduOpen, 0, 0, 0, 1, e.b)); err != nil {
+		return false, err
+	}
+	h, err := s.expectResponse(conn)
+	if err != nil {
+		return false, errors.New("could not open session: " + err.Error())
+	}
+	sessionID := h.SessionID
+
+	e = &encoder{}
+	e.b = append(e.b, 0, 127, 0, 0) // default timeout, default priority
+	e.oid(s.Root, false)
+	if _, err := conn.Write(pdu(pduRegister, 0, sessionID, 0, 2, e.b)); err != nil {
+		return false, err
+	}
+	if _, err := s.expectResponse(conn); err != nil {
+		return false, errors.New("could not register " + s.Root.String() + ": " + err.Error())
+	}
+	conn.SetDeadline(time.Time{})
+	log.Printf("Agentx registered %s with master agent %s:%s\n", s.Root, s.Network, s.Address)
+
+	for {
+		h, payload, err := readPDU(conn)
+		if err != nil {
+			return true, err
+		}
+		if h.Type == pduClose {
+			return true, errors.New("master agent closed the session")
+		}
+		response := s.handle(h, payload)
+		if response == nil {
+			continue
+		}
+		conn.SetWriteDeadline(time.Now().Add(timeOut))
+		if _, err := conn.Write(response); err != nil {
+			return true, err
+		}
+	}
+}
+
+// expectResponse reads a Response PDU and checks its error field.
+func (s *Sink) expectResponse(conn net.Conn) (header, error) {
+	h, payload, err := readPDU(conn)
+	if err != nil {
+		return h, err
+	}
+	if h.Type != pduResponse {
+		return h, fmt.Errorf("unexpected PDU type %d", h.Type)
+	}
+	d := &decoder{b: payload, order: h.order()}
+	d.uint32() // sysUpTime
+	if code := d.uint16(); code != 0 || d.err != nil {
+		return h, fmt.Errorf("master agent returned error %d", code)
+	}
+	return h, nil
+}
+
+// handle answers a request of the master agent. Sets are refused since all
+// our objects are read only.
+func (s *Sink) handle(h header, payload []byte) []byte {
+	d := &decoder{b: payload, order: h.order()}
+	if h.Flags&flagNonDefaultContext != 0 {
+		d.octetString()
+	}
+
+	var errorCode, errorIndex uint16
+	var varbinds []varbind
+	switch h.Type {
+	case pduGet, pduGetNext:
+		for _, r := range d.searchRanges() {
+			if h.Type == pduGet {
+				varbinds = append(varbinds, s.get(r.Start))
+			} else {
+				varbinds = append(varbinds, s.getNext(r))
+			}
+		}
+	case pduGetBulk:
+		nonRepeaters := int(d.uint16())
+		maxRepetitions := int(d.uint16())
+		ranges := d.searchRanges()
+		for i, r := range ranges {
+			if i < nonRepeaters {
+				varbinds = append(varbinds, s.getNext(r))
+				continue
+			}
+			for n := 0; n < maxRepetitions; n++ {
+				v := s.getNext(r)
+				varbinds = append(varbinds, v)
+				if v.Type == typeEndOfMibView {
+					break
+				}
+				r = searchRange{Start: v.Name, End: r.End}
+			}
+		}
+	case pduTestSet:
+		errorCode, errorIndex = errorNotWritable, 1
+	case pduCommitSet, pduUndoSet, pduCleanupSet:
+		if h.Type == pduCleanupSet { // CleanupSet has no response
+			return nil
+		}
+	default:
+		return nil
+	}
+	if d.err != nil {
+		errorCode, errorIndex, varbinds = errorProcessing, 0, nil
+	}
+
+	e := &encoder{}
+	e.uint32(0) // sysUpTime, the master fills it in
+	e.uint16(errorCode)
+	e.uint16(errorIndex)
+	for _, v := range varbinds {
+		e.varbind(v)
+	}
+	return pdu(pduResponse, 0, h.SessionID, h.TransactionID, h.PacketID, e.b)
+}
+
+// get returns the object with the given name. As RFC 2741 asks, if the name
+// is under one of our columns but there is no such row, it returns
+// noSuchInstance; if it is not under a column at all, noSuchObject.
+func (s *Sink) get(name oid) varbind {
+	table := s.snapshot()
+	i := sort.Search(len(table), func(i int) bool { return table[i].Name.compare(name) >= 0 })
+	if i < len(table) && table[i].Name.compare(name) == 0 {
+		return table[i]
+	}
+	entry := append(append(oid(nil), s.Root...), 1, 1)
+	if name.hasPrefix(entry) && len(name) > len(entry) && name[len(entry)] >= 1 && name[len(entry)] <= columns {
+		return varbind{Type: typeNoSuchInstance, Name: name}
+	}
+	return varbind{Type: typeNoSuchObject, Name: name}
+}
+
+// getNext returns the first object after the start of a range (or at it, if
+// the range includes its start) and before its end.
+func (s *Sink) getNext(r searchRange) varbind {
+	table := s.snapshot()
+	i := sort.Search(len(table), func(i int) bool {
+		c := table[i].Name.compare(r.Start)
+		return c > 0 || (c == 0 && r.Include)
+	})
+	if i < len(table) && (len(r.End) == 0 || table[i].Name.compare(r.End) < 0) {
+		return table[i]
+	}
+	return varbind{Type: typeEndOfMibView, Name: r.Start}
+}
+
+// snapshot returns our table, sorted by OID, rebuilding it if a scrape came
+// in since it was last built.
+func (s *Sink) snapshot() []varbind {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.dirty {
+		return s.table
+	}
+
+	var table []varbind
+	entry := append(append(oid(nil), s.Root...), 1, 1)
+	for instance, samples := range s.latest {
+		for _, sample := range samples {
+			var labels []string
+			for _, l := range sample.Labels {
+				if l.Name != "instance" {
+					labels = append(labels, l.Name+`="`+sensor.EscapeLabelValue(l.Value)+`"`)
+				}
+			}
+			labelString := strings.Join(labels, ",")
+			index := stringIndex(instance + "/" + sample.Name + "{" + labelString + "}")
+			values := map[int]varbind{
+				columnInstance: {Type: typeOctetString, String: instance},
+				columnMetric:   {Type: typeOctetString, String: sample.Name},
+				columnLabels:   {Type: typeOctetString, String: labelString},
+				columnValue:    {Type: typeOctetString, String: strconv.FormatFloat(sample.Value, 'f', -1, 64)},
+				columnMilli:    {Type: typeInteger, Integer: milli(sample.Value)},
+			}
+			for column := 1; column <= columns; column++ {
+				v := values[column]
+				v.Name = append(append(append(oid(nil), entry...), uint32(column)), index...)
+				table = append(table, v)
+			}
+		}
+	}
+	sort.Slice(table, func(i, j int) bool { return table[i].Name.compare(table[j].Name) < 0 })
+	s.table = table
+	s.dirty = false
+	return table
+}
+
+// stringIndex encodes a string as an OID index: its length followed by its
+// bytes. Long keys are cut and suffixed with a hash of the whole key, so they
+// stay unique.
+func stringIndex(key string) oid {
+	if len(key) > maxIndexLength {
+		h := fnv.New32a()
+		h.Write([]byte(key))
+		key = fmt.Sprintf("%s~%08x", key[:maxIndexLength-9], h.Sum32())
+	}
+	index := oid{uint32(len(key))}
+	for i := 0; i < len(key); i++ {
+		index = append(index, uint32(key[i]))
+	}
+	return index
+}
+
+// milli returns a value multiplied by 1000, clamped to an Integer32.
+func milli(value float64) int32 {
+	v := math.Round(value * 1000)
+	switch {
+	case math.IsNaN(v):
+		return 0
+	case v > math.MaxInt32:
+		return math.MaxInt32
+	case v < math.MinInt32:
+		return math.MinInt32
+	}
+	return int32(v)
+}
+
+func init() {
+	sensor.RegisterSink("agentx", NewSink, description)
+}
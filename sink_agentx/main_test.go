@@ -0,0 +1,132 @@
+//
+// Copyright 2016 Marios Andreopoulos
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package sink_agentx
+
+import (
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andmarios/sensor_exporter/sensor"
+)
+
+func init() {
+	retryInterval = 20 * time.Millisecond
+}
+
+func TestNewSinkOidLength(t *testing.T) {
+	for _, tt := range []struct {
+		length int
+		ok     bool
+	}{{28, true}, {29, false}} {
+		oid := strings.TrimSuffix(strings.Repeat("1.", tt.length), ".")
+		_, err := NewSink("address=unix:" + filepath.Join(t.TempDir(), "master") + ",oid=" + oid)
+		if (err == nil) != tt.ok {
+			t.Errorf("NewSink with an oid of %d sub-identifiers returned %v", tt.length, err)
+		}
+	}
+}
+
+// TestOutage checks that an outage is reported once, however many times we
+// retry, and that a new outage after a session is reported again.
+func TestOutage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "master")
+	sink, err := NewSink("address=unix:" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := sink.(sensor.AsyncSink).Errors()
+	count := func() int {
+		n := 0
+		for deadline := time.After(10 * retryInterval); ; {
+			select {
+			case <-errs:
+				n++
+			case <-deadline:
+				return n
+			}
+		}
+	}
+	if n := count(); n != 1 {
+		t.Fatalf("got %d errors whilst the master agent is down, want 1", n)
+	}
+
+	// Serve a single session, answering the open and register PDUs, then
+	// close it and go away.
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := l.Accept()
+	l.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		h, _, err := readPDU(conn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		e := &encoder{}
+		e.uint32(0)
+		e.uint16(0)
+		e.uint16(0)
+		conn.Write(pdu(pduResponse, 0, 1, h.TransactionID, h.PacketID, e.b))
+	}
+	conn.Write(pdu(pduClose, 0, 1, 0, 3, []byte{1, 0, 0, 0}))
+	conn.Close()
+	if n := count(); n != 1 {
+		t.Errorf("got %d errors after the session ended, want 1", n)
+	}
+}
+
+func TestGet(t *testing.T) {
+	root, _ := parseOid("1.3.6.1.4.1.8072.9999.9999.1")
+	s := &Sink{Root: root, latest: make(map[string][]sensor.Sample)}
+	s.Write(sensor.Scrape{Sensor: "example", Instance: "example-1", Time: time.Now(),
+		Output: "m{instance=\"example-1\"} 1\n"})
+
+	table := s.snapshot()
+	if len(table) != columns {
+		t.Fatalf("table has %d objects, want %d", len(table), columns)
+	}
+	if vb := s.get(table[0].Name); vb.Type == typeNoSuchObject || vb.Type == typeNoSuchInstance {
+		t.Errorf("get(%s) returned type %d for an existing object", table[0].Name, vb.Type)
+	}
+
+	tests := []struct {
+		name string
+		want uint16
+	}{
+		{root.String() + ".1.1.1.9.9.9", typeNoSuchInstance},
+		{root.String() + ".1.1.5.1", typeNoSuchInstance},
+		{root.String() + ".1.1.3", typeNoSuchInstance},
+		{root.String() + ".1.1.6.1", typeNoSuchObject},
+		{root.String() + ".1.1", typeNoSuchObject},
+		{root.String() + ".2", typeNoSuchObject},
+		{"1.3.6.1.2.1.1.1.0", typeNoSuchObject},
+	}
+	for _, tt := range tests {
+		name, _ := parseOid(tt.name)
+		if vb := s.get(name); vb.Type != tt.want {
+			t.Errorf("get(%s) returned type %d, want %d", tt.name, vb.Type, tt.want)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+//
+// Copyright 2016 Marios Andreopoulos
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+/*
+Package sink_example implements a simple sink that can be used as a
+template.
+
+In general your sink should have:
+
+(a) a Sink struct that implements the Write() function.
+(b) a function with a signature like NewSink() which creates a new sink.
+(c) use the init() function to register itself to the main package.
+
+Write is called from a single goroutine for each sink, so unlike sensors your
+sink does not have to be safe for concurrent use.
+*/
+package sink_example
+
+import (
+	"log"
+
+	"github.com/andmarios/sensor_exporter/sensor"
+)
+
+var description = `Example is an example sink that logs how many series each scrape returned.
+To use it with the default buffer:
+
+  sensor_exporter -sink example coretemp`
+
+type Sink struct {
+}
+
+func NewSink(opts string) (sensor.Sink, error) {
+	_ = opts // This sink does not have any option
+	return Sink{}, nil
+}
+
+func (s Sink) Write(scrape sensor.Scrape) error {
+	samples, err := scrape.Samples()
+	if err != nil {
+		return err
+	}
+	log.Printf("Sink example got %d series from %s at %s\n", len(samples), scrape.Instance, scrape.Time)
+	return nil
+}
+
+func init() {
+	sensor.RegisterSink("example", NewSink, description)
+}
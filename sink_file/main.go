@@ -0,0 +1,280 @@
+//
+// Copyright 2016 Marios Andreopoulos
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+/*
+Package sink_file records every reading to a local file, in CSV or JSON Lines
+format, for when there is no Prometheus around (e.g lab burn-in tests). Each
+record has the timestamp, sensor, instance, metric, labels and value of a
+reading.
+
+Files are rotated when they grow beyond a size or get older than an age.
+Rotated files are named after the time they were rotated, like
+readings.jsonl.20161017-150405.000, optionally compressed with gzip, and only the
+newest of them are kept.
+
+Its opts are comma separated key=value pairs:
+
+	path      the file to write to (required)
+	format    csv or jsonl (default jsonl)
+	max_size  rotate when the file grows beyond this many bytes (default 0, never)
+	max_age   rotate when the file is older than this, like 24h (default 0, never)
+	gzip      compress rotated files, true or false (default true)
+	keep      how many rotated files to keep (default 5, 0 keeps all)
+*/
+package sink_file
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/andmarios/sensor_exporter/sensor"
+)
+
+var description = `File records every reading to a local CSV or JSON Lines file with timestamp,
+sensor, instance, metric, labels and value, rotating it by size or age. Its opts
+are comma separated key=value pairs: path (required), format (csv or jsonl),
+max_size (bytes), max_age (like 24h), gzip (compress rotated files, default
+true) and keep (rotated files to keep, default 5). Example:
+
+  sensor_exporter -sink file,,path=/var/log/sensors.csv,format=csv,max_size=10485760 coretemp`
+
+var (
+	defaultKeep = 5
+	timeFormat  = "20060102-150405.000"
+	csvHeader   = []string{"timestamp", "sensor", "instance", "metric", "labels", "value"}
+)
+
+type Sink struct {
+	Path    string
+	Format  string
+	MaxSize int64
+	MaxAge  time.Duration
+	Gzip    bool
+	Keep    int
+	file    *os.File
+	size    int64
+	opened  time.Time
+}
+
+// A jsonRecord is a line of a JSON Lines file.
+type jsonRecord struct {
+	Timestamp string            `json:"timestamp"`
+	Sensor    string            `json:"sensor"`
+	Instance  string            `json:"instance"`
+	Metric    string            `json:"metric"`
+	Labels    map[string]string `json:"labels"`
+	Value     float64           `json:"value"`
+}
+
+func NewSink(opts string) (sensor.Sink, error) {
+	options, err := sensor.ParseOptions(opts)
+	if err != nil {
+		return nil, errors.New("File " + err.Error())
+	}
+	if options["path"] == "" {
+		return nil, errors.New("File needs a path option.")
+	}
+	s := &Sink{Path: options["path"], Format: options["format"], Gzip: true, Keep: defaultKeep}
+	switch s.Format {
+	case "":
+		s.Format = "jsonl"
+	case "csv", "jsonl":
+	default:
+		return nil, errors.New("File format should be csv or jsonl, not " + s.Format)
+	}
+	if options["max_size"] != "" {
+		s.MaxSize, err = strconv.ParseInt(options["max_size"], 10, 64)
+		if err != nil || s.MaxSize < 0 {
+			return nil, errors.New("File max_size should be a non negative number of bytes.")
+		}
+	}
+	if options["max_age"] != "" {
+		s.MaxAge, err = time.ParseDuration(options["max_age"])
+		if err != nil || s.MaxAge < 0 {
+			return nil, errors.New("File could not understand max_age: " + options["max_age"])
+		}
+	}
+	if options["gzip"] != "" {
+		s.Gzip, err = strconv.ParseBool(options["gzip"])
+		if err != nil {
+			return nil, errors.New("File gzip should be true or false, not " + options["gzip"])
+		}
+	}
+	if options["keep"] != "" {
+		s.Keep, err = strconv.Atoi(options["keep"])
+		if err != nil || s.Keep < 0 {
+			return nil, errors.New("File keep should be a non negative number.")
+		}
+	}
+
+	if err := s.open(); err != nil {
+		return nil, errors.New("File could not open " + s.Path + ": " + err.Error())
+	}
+	return s, nil
+}
+
+// open opens the file for appending. An existing file is continued; its age
+// counts from its modification time.
+func (s *Sink) open() error {
+	f, err := os.OpenFile(s.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	s.file, s.size, s.opened = f, info.Size(), time.Now()
+	if s.size > 0 {
+		s.opened = info.ModTime()
+	}
+	return nil
+}
+
+func (s *Sink) Write(scrape sensor.Scrape) error {
+	samples, err := scrape.Samples()
+	if err != nil {
+		return err
+	}
+
+	if s.file == nil {
+		if err := s.open(); err != nil {
+			return err
+		}
+	}
+	if (s.MaxSize > 0 && s.size >= s.MaxSize) || (s.MaxAge > 0 && time.Since(s.opened) >= s.MaxAge) {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	var b strings.Builder
+	timestamp := scrape.Time.UTC().Format(time.RFC3339Nano)
+	if s.Format == "csv" {
+		w := csv.NewWriter(&b)
+		if s.size == 0 {
+			w.Write(csvHeader)
+		}
+		for _, sample := range samples {
+			var labels []string
+			for _, l := range sample.Labels {
+				if l.Name != "instance" {
+					labels = append(labels, l.Name+"="+l.Value)
+				}
+			}
+			w.Write([]string{timestamp, scrape.Sensor, scrape.Instance, sample.Name,
+				strings.Join(labels, ";"), strconv.FormatFloat(sample.Value, 'g', -1, 64)})
+		}
+		w.Flush()
+	} else {
+		enc := json.NewEncoder(&b)
+		for _, sample := range samples {
+			r := jsonRecord{Timestamp: timestamp, Sensor: scrape.Sensor, Instance: scrape.Instance,
+				Metric: sample.Name, Labels: make(map[string]string), Value: sample.Value}
+			for _, l := range sample.Labels {
+				if l.Name != "instance" {
+					r.Labels[l.Name] = l.Value
+				}
+			}
+			// JSON can not carry NaN or infinite values.
+			if err := enc.Encode(r); err != nil {
+				continue
+			}
+		}
+	}
+
+	n, err := s.file.WriteString(b.String())
+	s.size += int64(n)
+	return err
+}
+
+// rotate moves the current file aside, compresses it if needed, removes old
+// rotated files and opens a new file.
+func (s *Sink) rotate() error {
+	s.file.Close()
+	s.file = nil
+	rotated := s.Path + "." + time.Now().Format(timeFormat)
+	if err := os.Rename(s.Path, rotated); err != nil {
+		return err
+	}
+	if s.Gzip {
+		if err := compress(rotated); err != nil {
+			sensor.LabelledIncident("file", "compress_error")
+			log.Printf("File could not compress %s. Err: %s\n", rotated, err)
+		}
+	}
+	s.prune()
+	return s.open()
+}
+
+// compress gzips a file and removes the original.
+func compress(filename string) error {
+	in, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(filename + ".gz")
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(out)
+	if _, err = io.Copy(gz, in); err == nil {
+		err = gz.Close()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(filename + ".gz")
+		return err
+	}
+	return os.Remove(filename)
+}
+
+// prune removes the oldest rotated files so at most Keep remain. Rotated file
+// names sort by the time they were rotated.
+func (s *Sink) prune() {
+	if s.Keep == 0 {
+		return
+	}
+	matches, err := filepath.Glob(s.Path + ".[0-9]*-[0-9]*")
+	if err != nil || len(matches) <= s.Keep {
+		return
+	}
+	sort.Strings(matches)
+	for _, f := range matches[:len(matches)-s.Keep] {
+		if err := os.Remove(f); err != nil {
+			log.Printf("File could not remove old file %s. Err: %s\n", f, err)
+		}
+	}
+}
+
+func init() {
+	sensor.RegisterSink("file", NewSink, description)
+}
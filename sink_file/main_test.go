@@ -0,0 +1,185 @@
+//
+// Copyright 2016 Marios Andreopoulos
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package sink_file
+
+import (
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andmarios/sensor_exporter/sensor"
+)
+
+var scrape = sensor.Scrape{
+	Sensor:   "coretemp",
+	Instance: "coretemp-1",
+	Time:     time.Date(2016, 10, 17, 15, 4, 5, 0, time.UTC),
+	Output: `# TYPE cpu_temperature_celsius gauge
+cpu_temperature_celsius{sensor="Core 0",socket="0",instance="coretemp-1"} 43.5
+cpu_temperature_celsius{sensor="Core 1",socket="0",instance="coretemp-1"} 44
+`,
+}
+
+func newSink(t *testing.T, opts string) *Sink {
+	s, err := NewSink(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s.(*Sink)
+}
+
+func TestWrite(t *testing.T) {
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"csv", `timestamp,sensor,instance,metric,labels,value
+2016-10-17T15:04:05Z,coretemp,coretemp-1,cpu_temperature_celsius,sensor=Core 0;socket=0,43.5
+2016-10-17T15:04:05Z,coretemp,coretemp-1,cpu_temperature_celsius,sensor=Core 1;socket=0,44
+2016-10-17T15:04:05Z,coretemp,coretemp-1,cpu_temperature_celsius,sensor=Core 0;socket=0,43.5
+2016-10-17T15:04:05Z,coretemp,coretemp-1,cpu_temperature_celsius,sensor=Core 1;socket=0,44
+`},
+		{"jsonl", `{"timestamp":"2016-10-17T15:04:05Z","sensor":"coretemp","instance":"coretemp-1","metric":"cpu_temperature_celsius","labels":{"sensor":"Core 0","socket":"0"},"value":43.5}
+{"timestamp":"2016-10-17T15:04:05Z","sensor":"coretemp","instance":"coretemp-1","metric":"cpu_temperature_celsius","labels":{"sensor":"Core 1","socket":"0"},"value":44}
+{"timestamp":"2016-10-17T15:04:05Z","sensor":"coretemp","instance":"coretemp-1","metric":"cpu_temperature_celsius","labels":{"sensor":"Core 0","socket":"0"},"value":43.5}
+{"timestamp":"2016-10-17T15:04:05Z","sensor":"coretemp","instance":"coretemp-1","metric":"cpu_temperature_celsius","labels":{"sensor":"Core 1","socket":"0"},"value":44}
+`},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "readings")
+		s := newSink(t, "path="+path+",format="+tt.format)
+		// The CSV header is only written to an empty file.
+		for i := 0; i < 2; i++ {
+			if err := s.Write(scrape); err != nil {
+				t.Fatal(err)
+			}
+		}
+		s.file.Close()
+		got, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s output =\n%s\nwant\n%s", tt.format, got, tt.want)
+		}
+	}
+}
+
+func TestRotate(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    string
+		age     time.Duration
+		rotated string // glob of the rotated file, empty if none is expected
+	}{
+		{"no limits", "", time.Hour, ""},
+		{"under max_size", ",max_size=100000", 0, ""},
+		{"max_size", ",max_size=100", 0, "readings.[0-9]*.gz"},
+		{"max_size without gzip", ",max_size=100,gzip=false", 0, "readings.[0-9]*[0-9]"},
+		{"under max_age", ",max_age=1h", time.Minute, ""},
+		{"max_age", ",max_age=1h", 2 * time.Hour, "readings.[0-9]*.gz"},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "readings")
+		s := newSink(t, "path="+path+tt.opts)
+		if err := s.Write(scrape); err != nil {
+			t.Fatal(err)
+		}
+		s.opened = s.opened.Add(-tt.age)
+		if err := s.Write(scrape); err != nil {
+			t.Fatal(err)
+		}
+		s.file.Close()
+
+		matches, _ := filepath.Glob(filepath.Join(dir, "readings.*"))
+		if tt.rotated == "" {
+			if len(matches) != 0 {
+				t.Errorf("%s: rotated to %v", tt.name, matches)
+			}
+			continue
+		}
+		if len(matches) != 1 {
+			t.Errorf("%s: rotated files = %v, want one", tt.name, matches)
+			continue
+		}
+		if ok, _ := filepath.Match(filepath.Join(dir, tt.rotated), matches[0]); !ok {
+			t.Errorf("%s: rotated file %s does not match %s", tt.name, matches[0], tt.rotated)
+		}
+
+		// The rotated file has the first scrape, the new one the second.
+		f, err := os.Open(matches[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		var r io.Reader = f
+		if strings.HasSuffix(matches[0], ".gz") {
+			if r, err = gzip.NewReader(f); err != nil {
+				t.Fatal(err)
+			}
+		}
+		old, err := ioutil.ReadAll(r)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		current, _ := ioutil.ReadFile(path)
+		if len(old) == 0 || string(old) != string(current) {
+			t.Errorf("%s: rotated file has %q, current file %q", tt.name, old, current)
+		}
+	}
+}
+
+func TestPrune(t *testing.T) {
+	// Rotated files sort by the time they were rotated; the others are never
+	// removed.
+	files := []string{"readings", "readings.20161017-100000.000.gz", "readings.20161017-110000.000",
+		"readings.20161017-120000.000.gz", "readings.20161017-130000.000.gz", "readings.csv"}
+	tests := []struct {
+		keep int
+		want []string
+	}{
+		{0, files},
+		{2, []string{"readings", "readings.20161017-120000.000.gz", "readings.20161017-130000.000.gz", "readings.csv"}},
+		{5, files},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		for _, name := range files {
+			if err := ioutil.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		s := &Sink{Path: filepath.Join(dir, "readings"), Keep: tt.keep}
+		s.prune()
+
+		var got []string
+		infos, _ := ioutil.ReadDir(dir)
+		for _, info := range infos {
+			got = append(got, info.Name())
+		}
+		if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+			t.Errorf("keep=%d left %v, want %v", tt.keep, got, tt.want)
+		}
+	}
+}
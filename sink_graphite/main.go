@@ -0,0 +1,248 @@
+//
+// Copyright 2016 Marios Andreopoulos
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+/*
+Package sink_graphite sends every reading to a Graphite/Carbon server using
+the plaintext protocol, over TCP or UDP.
+
+Its opts are comma separated key=value pairs:
+
+	address          the carbon server, like graphite:2003 (required)
+	protocol         tcp or udp (default tcp)
+	prefix           prefix for every path, like sensors
+	tags             labels added to every series, like host=web1;dc=eu1;
+	                 series that already have a label keep it (default
+	                 host=HOSTNAME)
+	template         path template for all metrics
+	template.METRIC  path template for a single metric (may be repeated)
+
+A template is a path where {name} is replaced by the metric name and {LABEL}
+by the value of a label, e.g:
+
+	template.hdd_temperature_celsius=sensors.{host}.hdd.{disk}.temp
+
+Without a template, the path is the metric name followed by the values of its
+labels, sorted by label name. Label values are sanitized so they do not add
+path levels. The host tag keeps the paths of many hosts apart and gives
+templates a {host}.
+*/
+package sink_graphite
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/andmarios/sensor_exporter/sensor"
+)
+
+var description = `Graphite sends every reading to a Graphite/Carbon server with the plaintext
+protocol over TCP or UDP. Its opts are comma separated key=value pairs: address
+(required), protocol (tcp or udp), prefix, tags (default host=HOSTNAME),
+template (for all metrics) and template.METRIC (for one metric). Templates use {name} for the metric name and
+{LABEL} for label values. Example:
+
+  sensor_exporter -sink graphite,,address=carbon:2003,template.hdd_temperature_celsius=sensors.{host}.hdd.{disk}.temp hddtemp`
+
+var (
+	timeOut = 5 * time.Second
+	// Carbon reads UDP datagrams whole, keep them below a common MTU.
+	maxDatagram = 1400
+)
+
+var (
+	placeholder = regexp.MustCompile(`\{([a-zA-Z_][a-zA-Z0-9_]*)\}`)
+	unsafeChars = regexp.MustCompile(`[^a-zA-Z0-9_\-]`)
+)
+
+type Sink struct {
+	Address   string
+	Protocol  string
+	Prefix    string
+	Template  string
+	Templates map[string]string
+	Tags      []sensor.Label
+	conn      net.Conn
+}
+
+func NewSink(opts string) (sensor.Sink, error) {
+	options, err := sensor.ParseOptions(opts)
+	if err != nil {
+		return nil, errors.New("Graphite " + err.Error())
+	}
+	if options["address"] == "" {
+		return nil, errors.New("Graphite needs an address option.")
+	}
+	s := &Sink{Address: options["address"], Protocol: options["protocol"], Prefix: options["prefix"],
+		Template: options["template"], Templates: make(map[string]string)}
+	switch s.Protocol {
+	case "":
+		s.Protocol = "tcp"
+	case "tcp", "udp":
+	default:
+		return nil, errors.New("Graphite protocol should be tcp or udp, not " + s.Protocol)
+	}
+	s.Tags, err = sensor.ExternalLabels(options, "tags")
+	if err != nil {
+		return nil, errors.New("Graphite " + err.Error())
+	}
+	for k, v := range options {
+		if strings.HasPrefix(k, "template.") {
+			s.Templates[strings.TrimPrefix(k, "template.")] = v
+		}
+	}
+
+	if err := s.connect(); err != nil {
+		log.Printf("Adding graphite sink at %s but could not connect to remote.\n", s.Address)
+	}
+	return s, nil
+}
+
+func (s *Sink) connect() error {
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+	conn, err := net.DialTimeout(s.Protocol, s.Address, timeOut)
+	if err != nil {
+		return err
+	}
+	s.conn = conn
+	return nil
+}
+
+// Write sends the readings of a scrape. If sending fails, we reconnect and
+// send the lines that did not make it once more before giving up on this
+// scrape.
+func (s *Sink) Write(scrape sensor.Scrape) error {
+	samples, err := scrape.Samples()
+	if err != nil {
+		return err
+	}
+	var lines []string
+	for _, sample := range samples {
+		if math.IsNaN(sample.Value) || math.IsInf(sample.Value, 0) {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s %g %d\n", s.path(sample), sample.Value, scrape.Time.Unix()))
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+
+	if s.conn == nil {
+		if err := s.connect(); err != nil {
+			return err
+		}
+	}
+	sent, err := s.send(lines)
+	if err == nil {
+		return nil
+	}
+	if err := s.connect(); err != nil {
+		return err
+	}
+	_, err = s.send(lines[sent:])
+	return err
+}
+
+// send writes lines to the connection and returns how many of them were
+// written whole. Carbon reads whole lines, so a line that was cut short has
+// to be sent again.
+func (s *Sink) send(lines []string) (int, error) {
+	s.conn.SetWriteDeadline(time.Now().Add(timeOut))
+	if s.Protocol == "tcp" {
+		data := []byte(strings.Join(lines, ""))
+		n, err := s.conn.Write(data)
+		return bytes.Count(data[:n], []byte("\n")), err
+	}
+	var b bytes.Buffer
+	sent, pending := 0, 0
+	for _, line := range lines {
+		if b.Len() > 0 && b.Len()+len(line) > maxDatagram {
+			if _, err := s.conn.Write(b.Bytes()); err != nil {
+				return sent, err
+			}
+			sent += pending
+			pending = 0
+			b.Reset()
+		}
+		b.WriteString(line)
+		pending++
+	}
+	if _, err := s.conn.Write(b.Bytes()); err != nil {
+		return sent, err
+	}
+	return sent + pending, nil
+}
+
+// path builds the graphite path of a sample from its template.
+func (s *Sink) path(sample sensor.Sample) string {
+	template, exists := s.Templates[sample.Name]
+	if !exists {
+		template = s.Template
+	}
+
+	// Tags are added unless the series has them already.
+	sample.Labels = append([]sensor.Label(nil), sample.Labels...)
+	for _, l := range s.Tags {
+		if sample.Label(l.Name) == "" {
+			sample.Labels = append(sample.Labels, l)
+		}
+	}
+
+	var path string
+	if template == "" {
+		labels := sample.Labels
+		sort.Slice(labels, func(i, j int) bool { return labels[i].Name < labels[j].Name })
+		path = sample.Name
+		for _, l := range labels {
+			path += "." + sanitize(l.Value)
+		}
+	} else {
+		path = placeholder.ReplaceAllStringFunc(template, func(p string) string {
+			name := p[1 : len(p)-1]
+			if name == "name" {
+				return sample.Name
+			}
+			return sanitize(sample.Label(name))
+		})
+	}
+	if s.Prefix != "" {
+		path = s.Prefix + "." + path
+	}
+	return path
+}
+
+// sanitize makes a label value safe to use as a single path level.
+func sanitize(value string) string {
+	if value == "" {
+		return "unknown"
+	}
+	return unsafeChars.ReplaceAllString(value, "_")
+}
+
+func init() {
+	sensor.RegisterSink("graphite", NewSink, description)
+}
@@ -0,0 +1,162 @@
+//
+// Copyright 2016 Marios Andreopoulos
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package sink_graphite
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andmarios/sensor_exporter/sensor"
+)
+
+var sample = sensor.Sample{Name: "hdd_temperature_celsius",
+	Labels: []sensor.Label{{Name: "instance", Value: "hddtemp-1"}, {Name: "disk", Value: "/dev/sda"}}, Value: 38}
+
+func TestPath(t *testing.T) {
+	hostname, _ := os.Hostname()
+	tests := []struct {
+		opts string
+		want string
+	}{
+		{"", "hdd_temperature_celsius._dev_sda." + sanitize(hostname) + ".hddtemp-1"},
+		{",tags=", "hdd_temperature_celsius._dev_sda.hddtemp-1"},
+		{",tags=host=web1;dc=eu1,prefix=sensors", "sensors.hdd_temperature_celsius.eu1._dev_sda.web1.hddtemp-1"},
+		{",tags=host=web1,template={host}.{name}.{disk}", "web1.hdd_temperature_celsius._dev_sda"},
+		{",tags=host=web1,template.hdd_temperature_celsius={host}.hdd.{disk}.{missing},template=x",
+			"web1.hdd._dev_sda.unknown"},
+		// A series that has the label already keeps its own value.
+		{",tags=instance=other,template={instance}", "hddtemp-1"},
+	}
+	for _, tt := range tests {
+		s, err := NewSink("address=127.0.0.1:1,protocol=udp" + tt.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := s.(*Sink).path(sample); got != tt.want {
+			t.Errorf("%q: path = %q, want %q", tt.opts, got, tt.want)
+		}
+	}
+	if sample.Labels[0].Name != "instance" || len(sample.Labels) != 2 {
+		t.Errorf("path changed the labels of the sample: %v", sample.Labels)
+	}
+}
+
+// shortConn accepts limit bytes, then fails.
+type shortConn struct {
+	net.Conn
+	limit int
+}
+
+func (c *shortConn) Write(b []byte) (int, error) {
+	if len(b) > c.limit {
+		return c.limit, errors.New("connection reset")
+	}
+	return len(b), nil
+}
+
+func (c *shortConn) SetWriteDeadline(t time.Time) error { return nil }
+func (c *shortConn) Close() error                       { return nil }
+
+func TestWriteResendsRest(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	// The sink connects when created and again after the failure.
+	received := make(chan string, 2)
+	go func() {
+		for i := 0; i < 2; i++ {
+			conn, err := l.Accept()
+			if err != nil {
+				received <- err.Error()
+				return
+			}
+			b, _ := ioutil.ReadAll(conn)
+			received <- string(b)
+		}
+	}()
+
+	s, err := NewSink("address=" + l.Addr().String() + ",tags=,template={name}.{sensor}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The first line and half the second make it, then the connection breaks.
+	s.(*Sink).conn.Close()
+	line := "m.a 1 1476000000\n"
+	s.(*Sink).conn = &shortConn{limit: len(line) + 5}
+	err = s.Write(sensor.Scrape{Time: time.Unix(1476000000, 0),
+		Output: "m{sensor=\"a\"} 1\nm{sensor=\"b\"} 2\nm{sensor=\"c\"} 3\n"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.(*Sink).conn.Close()
+
+	if got := <-received; got != "" {
+		t.Errorf("first connection got %q", got)
+	}
+	if got, want := <-received, "m.b 2 1476000000\nm.c 3 1476000000\n"; got != want {
+		t.Errorf("after reconnecting sent %q, want %q", got, want)
+	}
+}
+
+func TestWriteUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	s, err := NewSink("address=" + conn.LocalAddr().String() + ",protocol=udp,tags=,template={name}.{sensor}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Enough lines for two datagrams.
+	var output strings.Builder
+	for i := 0; i < 100; i++ {
+		output.WriteString("a_rather_long_metric_name_to_fill_datagrams{sensor=\"s\"} 1\n")
+	}
+	if err := s.Write(sensor.Scrape{Time: time.Unix(1476000000, 0), Output: output.String()}); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := 0
+	b := make([]byte, 65536)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for lines < 100 {
+		n, _, err := conn.ReadFrom(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n > maxDatagram {
+			t.Errorf("datagram of %d bytes is larger than %d", n, maxDatagram)
+		}
+		if !strings.HasSuffix(string(b[:n]), "\n") {
+			t.Error("datagram does not end with a whole line")
+		}
+		lines += strings.Count(string(b[:n]), "\n")
+	}
+	if lines != 100 {
+		t.Errorf("got %d lines, want 100", lines)
+	}
+}
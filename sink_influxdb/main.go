@@ -0,0 +1,323 @@
+//
+// Copyright 2016 Marios Andreopoulos
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+/*
+Package sink_influxdb writes scrapes to InfluxDB using the line protocol.
+Each series becomes a point whose measurement is the metric name, whose tags
+are the series' labels and which has a single field, value. Points are sent
+in batches to the v1 or v2 HTTP write API.
+
+Every point carries the sink's tags, host=HOSTNAME by default, so that points
+from many hosts written to the same database don't overwrite each other.
+
+Its opts are comma separated key=value pairs:
+
+	url        the InfluxDB url, like http://influxdb:8086 (required)
+	version    write API version, 1 or 2 (default 1)
+	db         database to write to (v1, required)
+	rp         retention policy (v1)
+	user       user for basic auth (v1)
+	password   password for basic auth (v1)
+	org        organization (v2, required)
+	bucket     bucket to write to (v2, required)
+	token      API token (v2)
+	tags       tags added to every point, like host=web1;dc=eu1; series that
+	           already have a label keep it (default host=HOSTNAME)
+	precision  timestamp precision: ns, us, ms or s (default s)
+	batch      points per write (default 500)
+	flush      flush points at least this often (default 10s)
+	retries    times to retry a failed write (default 3)
+
+See <https://docs.influxdata.com/influxdb/v1/write_protocols/line_protocol_reference/>.
+*/
+package sink_influxdb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andmarios/sensor_exporter/sensor"
+)
+
+var description = `Influxdb writes every series as an InfluxDB line protocol point (measurement
+from the metric name, tags from the labels, field value) in batches to the v1
+or v2 write API. Its opts are comma separated key=value pairs: url (required),
+version (1 or 2), db, rp, user, password (v1), org, bucket, token (v2), tags
+(default host=HOSTNAME), precision (ns, us, ms, s), batch, flush and retries.
+Example:
+
+  sensor_exporter -sink influxdb,,url=http://influx:8086,db=sensors coretemp hddtemp`
+
+var (
+	defaultBatch   = 500
+	defaultFlush   = 10 * time.Second
+	defaultRetries = 3
+	timeOut        = 10 * time.Second
+)
+
+// Precisions and how the v1 API calls them.
+var precisions = map[string]time.Duration{
+	"ns": time.Nanosecond,
+	"us": time.Microsecond,
+	"ms": time.Millisecond,
+	"s":  time.Second,
+}
+var v1Precisions = map[string]string{"ns": "n", "us": "u", "ms": "ms", "s": "s"}
+
+type Sink struct {
+	WriteUrl  string
+	User      string
+	Password  string
+	Token     string
+	Precision time.Duration
+	Batch     int
+	Retries   int
+	Tags      []sensor.Label
+	client    *http.Client
+	mutex     sync.Mutex
+	lines     []string
+	errors    sensor.SinkErrors
+}
+
+func NewSink(opts string) (sensor.Sink, error) {
+	options, err := sensor.ParseOptions(opts)
+	if err != nil {
+		return nil, errors.New("Influxdb " + err.Error())
+	}
+	if options["url"] == "" {
+		return nil, errors.New("Influxdb needs a url option.")
+	}
+	s := &Sink{Batch: defaultBatch, Retries: defaultRetries, client: &http.Client{Timeout: timeOut},
+		errors: sensor.NewSinkErrors()}
+
+	precision := options["precision"]
+	if precision == "" {
+		precision = "s"
+	}
+	var exists bool
+	if s.Precision, exists = precisions[precision]; !exists {
+		return nil, errors.New("Influxdb precision should be ns, us, ms or s, not " + precision)
+	}
+
+	query := url.Values{}
+	base := strings.TrimSuffix(options["url"], "/")
+	switch options["version"] {
+	case "", "1":
+		if options["db"] == "" {
+			return nil, errors.New("Influxdb v1 needs a db option.")
+		}
+		query.Set("db", options["db"])
+		if options["rp"] != "" {
+			query.Set("rp", options["rp"])
+		}
+		query.Set("precision", v1Precisions[precision])
+		s.WriteUrl = base + "/write?" + query.Encode()
+		s.User, s.Password = options["user"], options["password"]
+	case "2":
+		if options["org"] == "" || options["bucket"] == "" {
+			return nil, errors.New("Influxdb v2 needs org and bucket options.")
+		}
+		query.Set("org", options["org"])
+		query.Set("bucket", options["bucket"])
+		query.Set("precision", precision)
+		s.WriteUrl = base + "/api/v2/write?" + query.Encode()
+		s.Token = options["token"]
+	default:
+		return nil, errors.New("Influxdb version should be 1 or 2, not " + options["version"])
+	}
+
+	s.Tags, err = sensor.ExternalLabels(options, "tags")
+	if err != nil {
+		return nil, errors.New("Influxdb " + err.Error())
+	}
+	if options["batch"] != "" {
+		s.Batch, err = strconv.Atoi(options["batch"])
+		if err != nil || s.Batch <= 0 {
+			return nil, errors.New("Influxdb batch should be a positive number.")
+		}
+	}
+	if options["retries"] != "" {
+		s.Retries, err = strconv.Atoi(options["retries"])
+		if err != nil || s.Retries < 0 {
+			return nil, errors.New("Influxdb retries should be a non negative number.")
+		}
+	}
+	flush := defaultFlush
+	if options["flush"] != "" {
+		flush, err = time.ParseDuration(options["flush"])
+		if err != nil || flush <= 0 {
+			return nil, errors.New("Influxdb could not understand flush interval: " + options["flush"])
+		}
+	}
+
+	go s.flushLoop(flush)
+	return s, nil
+}
+
+// Write converts a scrape to points and sends them if a batch is complete.
+func (s *Sink) Write(scrape sensor.Scrape) error {
+	samples, err := scrape.Samples()
+	if err != nil {
+		return err
+	}
+	timestamp := scrape.Time.UnixNano() / int64(s.Precision)
+
+	s.mutex.Lock()
+	for _, sample := range samples {
+		// InfluxDB does not accept NaN or infinite fields.
+		if math.IsNaN(sample.Value) || math.IsInf(sample.Value, 0) {
+			continue
+		}
+		s.lines = append(s.lines, lineProtocol(sample, s.Tags, timestamp))
+	}
+	full := len(s.lines) >= s.Batch
+	s.mutex.Unlock()
+
+	if full {
+		return s.flush()
+	}
+	return nil
+}
+
+func (s *Sink) flushLoop(every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := s.flush(); err != nil {
+			s.errors.Send(errors.New("Influxdb could not write to " + s.WriteUrl + ": " + err.Error()))
+		}
+	}
+}
+
+// Errors returns the failures of the periodic flushes.
+func (s *Sink) Errors() <-chan error {
+	return s.errors
+}
+
+// flush sends the pending points in batches. A batch that fails even after
+// retrying is dropped.
+func (s *Sink) flush() error {
+	s.mutex.Lock()
+	lines := s.lines
+	s.lines = nil
+	s.mutex.Unlock()
+
+	var lastErr error
+	for len(lines) > 0 {
+		n := s.Batch
+		if n > len(lines) {
+			n = len(lines)
+		}
+		if err := s.send(strings.Join(lines[:n], "\n") + "\n"); err != nil {
+			lastErr = fmt.Errorf("dropped %d points: %s", n, err)
+		}
+		lines = lines[n:]
+	}
+	return lastErr
+}
+
+// send writes a batch, retrying with a growing pause on failures that may be
+// temporary.
+func (s *Sink) send(body string) error {
+	var err error
+	pause := time.Second
+	for try := 0; try <= s.Retries; try++ {
+		if try > 0 {
+			time.Sleep(pause)
+			pause *= 2
+		}
+		var retry bool
+		retry, err = s.post(body)
+		if err == nil || !retry {
+			return err
+		}
+	}
+	return err
+}
+
+func (s *Sink) post(body string) (retry bool, e error) {
+	req, err := http.NewRequest(http.MethodPost, s.WriteUrl, strings.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if s.Token != "" {
+		req.Header.Set("Authorization", "Token "+s.Token)
+	} else if s.User != "" {
+		req.SetBasicAuth(s.User, s.Password)
+	}
+	res, err := s.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 == 2 {
+		return false, nil
+	}
+	msg, _ := ioutil.ReadAll(io.LimitReader(res.Body, 512))
+	err = fmt.Errorf("influxdb returned %s: %s", res.Status, bytes.TrimSpace(msg))
+	return res.StatusCode/100 == 5 || res.StatusCode == http.StatusTooManyRequests, err
+}
+
+var (
+	measurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+	tagEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+)
+
+// lineProtocol formats a sample as a point, like:
+//
+//	cpu_temperature_celsius,instance=coretemp-1,sensor=Core\ 0 value=41 1476000000
+//
+// The sink's tags are added unless the series has them already. Tags are
+// sorted by key, as InfluxDB prefers, and empty tag values are skipped since
+// the line protocol does not allow them.
+func lineProtocol(sample sensor.Sample, tags []sensor.Label, timestamp int64) string {
+	labels := append([]sensor.Label(nil), sample.Labels...)
+	for _, t := range tags {
+		if sample.Label(t.Name) == "" {
+			labels = append(labels, t)
+		}
+	}
+	sort.Slice(labels, func(i, j int) bool { return labels[i].Name < labels[j].Name })
+
+	var b strings.Builder
+	b.WriteString(measurementEscaper.Replace(sample.Name))
+	for _, l := range labels {
+		if l.Value == "" {
+			continue
+		}
+		b.WriteString("," + tagEscaper.Replace(l.Name) + "=" + tagEscaper.Replace(l.Value))
+	}
+	b.WriteString(" value=" + strconv.FormatFloat(sample.Value, 'g', -1, 64))
+	b.WriteString(" " + strconv.FormatInt(timestamp, 10))
+	return b.String()
+}
+
+func init() {
+	sensor.RegisterSink("influxdb", NewSink, description)
+}
@@ -0,0 +1,46 @@
+//
+// Copyright 2016 Marios Andreopoulos
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package sink_influxdb
+
+import (
+	"testing"
+
+	"github.com/andmarios/sensor_exporter/sensor"
+)
+
+func TestLineProtocol(t *testing.T) {
+	tags := []sensor.Label{{Name: "host", Value: "web1"}}
+	tests := []struct {
+		sample sensor.Sample
+		tags   []sensor.Label
+		want   string
+	}{
+		{sensor.Sample{Name: "cpu_temperature_celsius",
+			Labels: []sensor.Label{{Name: "sensor", Value: "Core 0"}, {Name: "instance", Value: "coretemp-1"}}, Value: 41},
+			tags, `cpu_temperature_celsius,host=web1,instance=coretemp-1,sensor=Core\ 0 value=41 1476000000`},
+		{sensor.Sample{Name: "m", Labels: []sensor.Label{{Name: "host", Value: "nas"}}, Value: 1},
+			tags, `m,host=nas value=1 1476000000`},
+		{sensor.Sample{Name: "m", Labels: []sensor.Label{{Name: "a", Value: "x,y=z"}, {Name: "b", Value: ""}}, Value: 0.5},
+			nil, `m,a=x\,y\=z value=0.5 1476000000`},
+	}
+	for _, tt := range tests {
+		if got := lineProtocol(tt.sample, tt.tags, 1476000000); got != tt.want {
+			t.Errorf("lineProtocol() = %q, want %q", got, tt.want)
+		}
+	}
+}
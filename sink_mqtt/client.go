@@ -0,0 +1,255 @@
+//
+// Copyright 2016 Marios Andreopoulos
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package sink_mqtt
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// A client is a minimal MQTT 3.1.1 client. It can only publish with QoS 0,
+// which is all we need, and keeps its connection alive with pings.
+//
+// See <http://docs.oasis-open.org/mqtt/mqtt/v3.1.1/os/mqtt-v3.1.1-os.html>.
+type client struct {
+	conn   net.Conn
+	mutex  sync.Mutex
+	closed chan struct{}
+}
+
+// Control packet types
+const (
+	packetConnect = 1
+	packetConnack = 2
+	packetPublish = 3
+	packetPingreq = 12
+)
+
+type connectOptions struct {
+	ClientID    string
+	User        string
+	Password    string
+	KeepAlive   time.Duration
+	WillTopic   string
+	WillMessage string
+	WillRetain  bool
+}
+
+var connackErrors = map[byte]string{
+	1: "unacceptable protocol version",
+	2: "client identifier rejected",
+	3: "server unavailable",
+	4: "bad user name or password",
+	5: "not authorized",
+}
+
+// dial connects to a broker and waits for its CONNACK.
+func dial(address string, opts connectOptions, timeOut time.Duration) (*client, error) {
+	conn, err := net.DialTimeout("tcp", address, timeOut)
+	if err != nil {
+		return nil, err
+	}
+
+	// Variable header: protocol name, level 4, flags and keep alive.
+	var flags byte = 0x02 // clean session
+	if opts.WillTopic != "" {
+		flags |= 0x04
+		if opts.WillRetain {
+			flags |= 0x20
+		}
+	}
+	if opts.User != "" {
+		flags |= 0x80
+		if opts.Password != "" {
+			flags |= 0x40
+		}
+	}
+	keepAlive := uint16(opts.KeepAlive / time.Second)
+	body := appendString(nil, "MQTT")
+	body = append(body, 4, flags, byte(keepAlive>>8), byte(keepAlive))
+
+	// Payload, in the order the spec sets.
+	body = appendString(body, opts.ClientID)
+	if opts.WillTopic != "" {
+		body = appendString(body, opts.WillTopic)
+		body = appendString(body, opts.WillMessage)
+	}
+	if opts.User != "" {
+		body = appendString(body, opts.User)
+		if opts.Password != "" {
+			body = appendString(body, opts.Password)
+		}
+	}
+
+	conn.SetDeadline(time.Now().Add(timeOut))
+	if _, err := conn.Write(packet(packetConnect<<4, body)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	ack := make([]byte, 4)
+	if _, err := io.ReadFull(conn, ack); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if ack[0] != packetConnack<<4 || ack[1] != 2 {
+		conn.Close()
+		return nil, errors.New("broker did not acknowledge connection")
+	}
+	if ack[3] != 0 {
+		conn.Close()
+		if msg, exists := connackErrors[ack[3]]; exists {
+			return nil, errors.New("broker refused connection: " + msg)
+		}
+		return nil, errors.New("broker refused connection")
+	}
+	conn.SetDeadline(time.Time{})
+
+	c := &client{conn: conn, closed: make(chan struct{})}
+	go c.readLoop()
+	if keepAlive > 0 {
+		go c.pingLoop(opts.KeepAlive / 2)
+	}
+	return c, nil
+}
+
+// readLoop discards whatever the broker sends us (ping responses), until the
+// connection breaks.
+func (c *client) readLoop() {
+	r := bufio.NewReader(c.conn)
+	for {
+		if _, err := r.ReadByte(); err != nil {
+			c.Close()
+			return
+		}
+		length, err := readRemainingLength(r)
+		if err != nil {
+			c.Close()
+			return
+		}
+		if _, err := r.Discard(length); err != nil {
+			c.Close()
+			return
+		}
+	}
+}
+
+func (c *client) pingLoop(every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.closed:
+			return
+		case <-ticker.C:
+			if err := c.write(packet(packetPingreq<<4, nil)); err != nil {
+				c.Close()
+				return
+			}
+		}
+	}
+}
+
+// Publish sends a message with QoS 0.
+func (c *client) Publish(topic string, payload []byte, retain bool) error {
+	var header byte = packetPublish << 4
+	if retain {
+		header |= 0x01
+	}
+	body := appendString(nil, topic)
+	body = append(body, payload...)
+	return c.write(packet(header, body))
+}
+
+func (c *client) write(p []byte) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	select {
+	case <-c.closed:
+		return errors.New("connection is closed")
+	default:
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	_, err := c.conn.Write(p)
+	return err
+}
+
+// Closed reports whether the connection is closed.
+func (c *client) Closed() bool {
+	select {
+	case <-c.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close closes the connection without a DISCONNECT, so the broker publishes
+// our will.
+func (c *client) Close() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	select {
+	case <-c.closed:
+	default:
+		close(c.closed)
+		c.conn.Close()
+	}
+}
+
+func packet(header byte, body []byte) []byte {
+	p := []byte{header}
+	// Remaining length is a variable length integer, 7 bits per byte.
+	n := len(body)
+	for {
+		b := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			b |= 0x80
+		}
+		p = append(p, b)
+		if n == 0 {
+			break
+		}
+	}
+	return append(p, body...)
+}
+
+func readRemainingLength(r *bufio.Reader) (int, error) {
+	n, multiplier := 0, 1
+	for i := 0; i < 4; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		n += int(b&0x7f) * multiplier
+		if b&0x80 == 0 {
+			return n, nil
+		}
+		multiplier *= 128
+	}
+	return 0, errors.New("malformed remaining length")
+}
+
+func appendString(b []byte, s string) []byte {
+	b = append(b, byte(len(s)>>8), byte(len(s)))
+	return append(b, s...)
+}
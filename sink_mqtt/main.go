@@ -0,0 +1,293 @@
+//
+// Copyright 2016 Marios Andreopoulos
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+/*
+Package sink_mqtt publishes every series to an MQTT broker as a retained
+message, so that home automation software like Home Assistant can use them.
+
+Each series is published under PREFIX/SENSOR/METRIC/LABELS, where SENSOR is
+the sensor type followed by its opts, if any, and LABELS are the values of its
+labels but instance, sorted by label name, e.g:
+
+	sensor_exporter/myhost/coretemp/cpu_temperature_celsius/Core_0 41
+	sensor_exporter/myhost/upsc_MYUPS_nas/upsc_battery_charge/nas/MYUPS 100
+
+We don't use the instance label, since it changes when the sensors are given
+in another order, and so would the topics and Home Assistant entities.
+
+The availability topic PREFIX/status is set to online when we connect and to
+offline, through the broker's last will, when sensor_exporter dies. The default
+prefix includes the hostname, so many hosts can share a broker; a custom
+prefix must be unique per host too.
+
+With discovery enabled, a Home Assistant MQTT discovery config is published
+for every series, with a device class and unit derived from its metric name's
+unit suffix. Its unique_id starts with the client id, so it is unique across
+hosts.
+
+Its opts are comma separated key=value pairs:
+
+	broker            the broker, like mqtt:1883 (required)
+	client_id         the MQTT client id (default sensor_exporter-HOSTNAME)
+	user              user name
+	password          password
+	prefix            topic prefix (default sensor_exporter/HOSTNAME)
+	discovery         publish Home Assistant discovery configs, true or false
+	discovery_prefix  Home Assistant discovery prefix (default homeassistant)
+	keepalive         MQTT keep alive (default 60s)
+*/
+package sink_mqtt
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/andmarios/sensor_exporter/sensor"
+)
+
+var description = `Mqtt publishes every series as a retained message to an MQTT broker under
+PREFIX/SENSOR/METRIC/LABELS, with PREFIX/status as availability topic. It can
+also publish Home Assistant discovery configs. Its opts are comma separated
+key=value pairs: broker (required), client_id, user, password, prefix,
+discovery (true or false), discovery_prefix and keepalive. Example:
+
+  sensor_exporter -sink mqtt,,broker=mqtt:1883,discovery=true coretemp hddtemp upsc,,MYUPS`
+
+var (
+	timeOut          = 10 * time.Second
+	defaultKeepAlive = 60 * time.Second
+	unsafeChars      = regexp.MustCompile(`[^a-zA-Z0-9_\-]`)
+)
+
+type Sink struct {
+	Broker          string
+	Prefix          string
+	Discovery       bool
+	DiscoveryPrefix string
+	options         connectOptions
+	client          *client
+	discovered      map[string]bool
+}
+
+func NewSink(opts string) (sensor.Sink, error) {
+	options, err := sensor.ParseOptions(opts)
+	if err != nil {
+		return nil, errors.New("Mqtt " + err.Error())
+	}
+	if options["broker"] == "" {
+		return nil, errors.New("Mqtt needs a broker option.")
+	}
+	s := &Sink{Broker: options["broker"], Prefix: options["prefix"],
+		DiscoveryPrefix: options["discovery_prefix"], discovered: make(map[string]bool)}
+	if _, _, err := net.SplitHostPort(s.Broker); err != nil {
+		s.Broker += ":1883"
+	}
+	hostname, _ := os.Hostname()
+	if s.Prefix == "" {
+		s.Prefix = "sensor_exporter/" + sanitize(hostname)
+	}
+	if s.DiscoveryPrefix == "" {
+		s.DiscoveryPrefix = "homeassistant"
+	}
+	if options["discovery"] != "" {
+		s.Discovery, err = strconv.ParseBool(options["discovery"])
+		if err != nil {
+			return nil, errors.New("Mqtt discovery should be true or false, not " + options["discovery"])
+		}
+	}
+
+	s.options = connectOptions{ClientID: options["client_id"], User: options["user"],
+		Password: options["password"], KeepAlive: defaultKeepAlive,
+		WillTopic: s.Prefix + "/status", WillMessage: "offline", WillRetain: true}
+	if s.options.ClientID == "" {
+		s.options.ClientID = "sensor_exporter-" + hostname
+	}
+	if options["keepalive"] != "" {
+		s.options.KeepAlive, err = time.ParseDuration(options["keepalive"])
+		if err != nil || s.options.KeepAlive < time.Second {
+			return nil, errors.New("Mqtt could not understand keepalive: " + options["keepalive"])
+		}
+	}
+
+	if err := s.connect(); err != nil {
+		log.Printf("Adding mqtt sink at %s but could not connect to broker: %s\n", s.Broker, err)
+	}
+	return s, nil
+}
+
+// connect connects to the broker and marks us as online. Discovery configs
+// are sent again after a reconnect, in case the broker lost them.
+func (s *Sink) connect() error {
+	c, err := dial(s.Broker, s.options, timeOut)
+	if err != nil {
+		return err
+	}
+	if err := c.Publish(s.options.WillTopic, []byte("online"), true); err != nil {
+		c.Close()
+		return err
+	}
+	s.client = c
+	s.discovered = make(map[string]bool)
+	return nil
+}
+
+func (s *Sink) Write(scrape sensor.Scrape) error {
+	samples, err := scrape.Samples()
+	if err != nil {
+		return err
+	}
+	if s.client == nil || s.client.Closed() {
+		if err := s.connect(); err != nil {
+			return err
+		}
+	}
+
+	for _, sample := range samples {
+		topic, id := s.topic(scrape, sample)
+		if s.Discovery && !s.discovered[id] {
+			if err := s.publishDiscovery(scrape.Sensor, topic, id, sample); err != nil {
+				return err
+			}
+			s.discovered[id] = true
+		}
+		value := strconv.FormatFloat(sample.Value, 'f', -1, 64)
+		if err := s.client.Publish(topic, []byte(value), true); err != nil {
+			s.client.Close()
+			return err
+		}
+	}
+	return nil
+}
+
+// topic returns the state topic of a series and an id, unique for the series,
+// that can be used in MQTT topics and as Home Assistant's unique_id.
+func (s *Sink) topic(scrape sensor.Scrape, sample sensor.Sample) (string, string) {
+	labels := append([]sensor.Label(nil), sample.Labels...)
+	sort.Slice(labels, func(i, j int) bool { return labels[i].Name < labels[j].Name })
+	source := sanitize(scrape.Sensor)
+	if scrape.Opts != "" {
+		source += "_" + sanitize(scrape.Opts)
+	}
+	parts := []string{source, sample.Name}
+	for _, l := range labels {
+		if l.Name == "instance" {
+			continue
+		}
+		parts = append(parts, sanitize(l.Value))
+	}
+	return s.Prefix + "/" + strings.Join(parts, "/"), strings.Join(parts, "_")
+}
+
+func sanitize(value string) string {
+	if value == "" {
+		return "unknown"
+	}
+	return unsafeChars.ReplaceAllString(value, "_")
+}
+
+// A haUnit maps a metric name pattern to Home Assistant's device class and
+// unit. The first match wins. Patterns are anchored to the unit suffix of
+// the name, since words like power or temperature also appear in metrics that
+// are not measured in watts or degrees (power_supply_online,
+// cpu_temperature_crit_alarm).
+type haUnit struct {
+	re          *regexp.Regexp
+	deviceClass string
+	unit        string
+}
+
+var haUnits = []haUnit{
+	// States, counts and ratios have no unit.
+	{regexp.MustCompile(`(_alarm|_online|_status|_count|_ratio)$`), "", ""},
+	{regexp.MustCompile(`_celsius$`), "temperature", "°C"},
+	{regexp.MustCompile(`_volts$`), "voltage", "V"},
+	{regexp.MustCompile(`_amperes$`), "current", "A"},
+	{regexp.MustCompile(`_watts$`), "power", "W"},
+	// Watt hours measure stored energy; Home Assistant does not allow the
+	// energy class with the measurement state class.
+	{regexp.MustCompile(`_watthours$`), "energy_storage", "Wh"},
+	{regexp.MustCompile(`_amperehours$`), "", "Ah"},
+	{regexp.MustCompile(`_hertz$`), "frequency", "Hz"},
+	{regexp.MustCompile(`_seconds$`), "duration", "s"},
+	{regexp.MustCompile(`^power_supply_capacity_percent$`), "battery", "%"},
+	{regexp.MustCompile(`_percent$`), "", "%"},
+	{regexp.MustCompile(`_rpm$`), "", "RPM"},
+	// The upsc sensor predates unit suffixes, so its metrics are matched
+	// by their full names.
+	{regexp.MustCompile(`^upsc_battery_charge$`), "battery", "%"},
+	{regexp.MustCompile(`^upsc_ups_load$`), "", "%"},
+	{regexp.MustCompile(`^upsc_(battery|input|output)_voltage$`), "voltage", "V"},
+	{regexp.MustCompile(`^upsc_input_current$`), "current", "A"},
+	{regexp.MustCompile(`^upsc_input_frequency$`), "frequency", "Hz"},
+	{regexp.MustCompile(`^upsc_ups_temperature$`), "temperature", "°C"},
+}
+
+// publishDiscovery publishes the Home Assistant discovery config of a series.
+func (s *Sink) publishDiscovery(sensorType, topic, id string, sample sensor.Sample) error {
+	uniqueID := sanitize(s.options.ClientID) + "_" + id
+	config := map[string]interface{}{
+		"name":               strings.Replace(id, "_", " ", -1),
+		"unique_id":          uniqueID,
+		"object_id":          uniqueID,
+		"state_topic":        topic,
+		"availability_topic": s.options.WillTopic,
+		"device": map[string]interface{}{
+			"identifiers":  []string{s.options.ClientID},
+			"name":         s.options.ClientID,
+			"manufacturer": "sensor_exporter",
+		},
+	}
+	if sensor.MetricType(sensorType, sample.Name) == "counter" {
+		config["state_class"] = "total_increasing"
+	} else {
+		config["state_class"] = "measurement"
+	}
+	for _, u := range haUnits {
+		if u.re.MatchString(sample.Name) {
+			if u.deviceClass != "" {
+				config["device_class"] = u.deviceClass
+			}
+			if u.unit != "" {
+				config["unit_of_measurement"] = u.unit
+			}
+			break
+		}
+	}
+
+	payload, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	discoveryTopic := s.DiscoveryPrefix + "/sensor/" + sanitize(s.options.ClientID) + "/" + id + "/config"
+	if err := s.client.Publish(discoveryTopic, payload, true); err != nil {
+		s.client.Close()
+		return err
+	}
+	return nil
+}
+
+func init() {
+	sensor.RegisterSink("mqtt", NewSink, description)
+}
@@ -0,0 +1,121 @@
+//
+// Copyright 2016 Marios Andreopoulos
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package sink_mqtt
+
+import (
+	"os"
+	"testing"
+
+	"github.com/andmarios/sensor_exporter/sensor"
+)
+
+func haUnitOf(name string) (string, string) {
+	for _, u := range haUnits {
+		if u.re.MatchString(name) {
+			return u.deviceClass, u.unit
+		}
+	}
+	return "", ""
+}
+
+func TestHAUnits(t *testing.T) {
+	tests := []struct {
+		name, deviceClass, unit string
+	}{
+		{"cpu_temperature_celsius", "temperature", "°C"},
+		{"cpu_temperature_crit_alarm", "", ""},
+		{"nvme_temperature_alarm", "", ""},
+		{"power_supply_online", "", ""},
+		{"power_supply_status", "", ""},
+		{"power_supply_cycle_count", "", ""},
+		{"power_supply_capacity_percent", "battery", "%"},
+		{"cpu_throttle_percent", "", "%"},
+		{"power_supply_energy_watthours", "energy_storage", "Wh"},
+		{"power_supply_charge_amperehours", "", "Ah"},
+		{"power_supply_power_watts", "power", "W"},
+		{"power_supply_voltage_volts", "voltage", "V"},
+		{"power_supply_current_amperes", "current", "A"},
+		{"rapl_power_limit_time_window_seconds", "duration", "s"},
+		{"rapl_power_limit_watts", "power", "W"},
+		{"hwmon_pwm_ratio", "", ""},
+		{"hwmon_fan_rpm", "", "RPM"},
+		{"cpu_frequency_hertz", "frequency", "Hz"},
+		{"thermal_cooling_device_cur_state", "", ""},
+		{"upsc_battery_charge", "battery", "%"},
+		{"upsc_battery_voltage", "voltage", "V"},
+		{"upsc_ups_load", "", "%"},
+		{"upsc_ups_temperature", "temperature", "°C"},
+	}
+	for _, tt := range tests {
+		deviceClass, unit := haUnitOf(tt.name)
+		if deviceClass != tt.deviceClass || unit != tt.unit {
+			t.Errorf("%s got device class %q and unit %q, want %q and %q",
+				tt.name, deviceClass, unit, tt.deviceClass, tt.unit)
+		}
+	}
+}
+
+func TestHostIdentity(t *testing.T) {
+	hostname, _ := os.Hostname()
+	// Nothing listens on port 1, so the sink is created without a connection.
+	sink, err := NewSink("broker=127.0.0.1:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := sink.(*Sink)
+	if want := "sensor_exporter/" + sanitize(hostname); s.Prefix != want {
+		t.Errorf("prefix is %q, want %q", s.Prefix, want)
+	}
+	if want := "sensor_exporter/" + sanitize(hostname) + "/status"; s.options.WillTopic != want {
+		t.Errorf("availability topic is %q, want %q", s.options.WillTopic, want)
+	}
+	if want := "sensor_exporter-" + hostname; s.options.ClientID != want {
+		t.Errorf("client id is %q, want %q", s.options.ClientID, want)
+	}
+}
+
+func TestTopic(t *testing.T) {
+	s := &Sink{Prefix: "sensor_exporter/web1"}
+	tests := []struct {
+		scrape sensor.Scrape
+		sample sensor.Sample
+		topic  string
+		id     string
+	}{
+		{sensor.Scrape{Sensor: "coretemp", Instance: "coretemp-1"},
+			sensor.Sample{Name: "cpu_temperature_celsius", Labels: []sensor.Label{
+				{Name: "sensor", Value: "Core 0"}, {Name: "instance", Value: "coretemp-1"}, {Name: "socket", Value: "0"}}},
+			"sensor_exporter/web1/coretemp/cpu_temperature_celsius/Core_0/0",
+			"coretemp_cpu_temperature_celsius_Core_0_0"},
+		// The instance label depends on the order of the sensors; the opts
+		// tell sensors of the same type apart instead.
+		{sensor.Scrape{Sensor: "upsc", Instance: "upsc-2", Opts: "MYUPS@nas"},
+			sensor.Sample{Name: "upsc_battery_charge", Labels: []sensor.Label{
+				{Name: "ups", Value: "MYUPS"}, {Name: "host", Value: "nas"}, {Name: "instance", Value: "upsc-2"}}},
+			"sensor_exporter/web1/upsc_MYUPS_nas/upsc_battery_charge/nas/MYUPS",
+			"upsc_MYUPS_nas_upsc_battery_charge_nas_MYUPS"},
+		{sensor.Scrape{Sensor: "log", Instance: "log-1"}, sensor.Sample{Name: "sensor_exporter_incidents"},
+			"sensor_exporter/web1/log/sensor_exporter_incidents", "log_sensor_exporter_incidents"},
+	}
+	for _, tt := range tests {
+		topic, id := s.topic(tt.scrape, tt.sample)
+		if topic != tt.topic || id != tt.id {
+			t.Errorf("topic = %q, id = %q, want %q and %q", topic, id, tt.topic, tt.id)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+//
+// Copyright 2016 Marios Andreopoulos
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+/*
+Package sink_otlp exports scrapes to an OpenTelemetry collector with the
+OTLP/HTTP protocol, encoded as protobuf. Metrics that a sensor declares as
+counters become monotonic cumulative sums; all others become gauges. Each
+scrape is sent with resource attributes for the host and the sensor:
+
+	service.name     sensor_exporter
+	host.name        the host name
+	sensor.type      the sensor type, like coretemp
+	sensor.instance  the sensor instance, like coretemp-1
+
+Its opts are comma separated key=value pairs:
+
+	url          the OTLP metrics endpoint (default http://localhost:4318/v1/metrics)
+	header.NAME  an extra HTTP header, e.g for authentication (may be repeated)
+	host         the host.name attribute (default the host name)
+
+See <https://opentelemetry.io/docs/specs/otlp/>.
+*/
+package sink_otlp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/andmarios/sensor_exporter/internal/protobuf"
+	"github.com/andmarios/sensor_exporter/sensor"
+)
+
+var description = `Otlp exports scrapes to an OpenTelemetry collector with OTLP/HTTP protobuf.
+Counters become monotonic sums and everything else gauges, with resource
+attributes for the host and sensor. Its opts are comma separated key=value
+pairs: url (default http://localhost:4318/v1/metrics), header.NAME (extra HTTP
+headers) and host (host.name attribute). Example:
+
+  sensor_exporter -sink otlp,,url=http://otel:4318/v1/metrics coretemp hddtemp`
+
+var (
+	defaultUrl = "http://localhost:4318/v1/metrics"
+	timeOut    = 10 * time.Second
+)
+
+// aggregationTemporalityCumulative is AGGREGATION_TEMPORALITY_CUMULATIVE.
+const aggregationTemporalityCumulative = 2
+
+type Sink struct {
+	Url     string
+	Host    string
+	Headers map[string]string
+	client  *http.Client
+}
+
+func NewSink(opts string) (sensor.Sink, error) {
+	options, err := sensor.ParseOptions(opts)
+	if err != nil {
+		return nil, errors.New("Otlp " + err.Error())
+	}
+	s := &Sink{Url: options["url"], Host: options["host"], Headers: make(map[string]string),
+		client: &http.Client{Timeout: timeOut}}
+	if s.Url == "" {
+		s.Url = defaultUrl
+	}
+	if s.Host == "" {
+		s.Host, _ = os.Hostname()
+	}
+	for k, v := range options {
+		if strings.HasPrefix(k, "header.") {
+			s.Headers[strings.TrimPrefix(k, "header.")] = v
+		}
+	}
+	return s, nil
+}
+
+func (s *Sink) Write(scrape sensor.Scrape) error {
+	samples, err := scrape.Samples()
+	if err != nil {
+		return err
+	}
+	if len(samples) == 0 {
+		return nil
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.Url, bytes.NewReader(s.encode(scrape, samples)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	for k, v := range s.Headers {
+		req.Header.Set(k, v)
+	}
+	res, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(res.Body, 512))
+		return fmt.Errorf("collector returned %s: %s", res.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// encode builds an ExportMetricsServiceRequest with a single ResourceMetrics:
+//
+//	ExportMetricsServiceRequest { repeated ResourceMetrics resource_metrics = 1; }
+//	ResourceMetrics { Resource resource = 1; repeated ScopeMetrics scope_metrics = 2; }
+//	Resource { repeated KeyValue attributes = 1; }
+//	ScopeMetrics { InstrumentationScope scope = 1; repeated Metric metrics = 2; }
+//	Metric { string name = 1; string description = 2; Gauge gauge = 5; Sum sum = 7; }
+//	Gauge { repeated NumberDataPoint data_points = 1; }
+//	Sum { repeated NumberDataPoint data_points = 1; int aggregation_temporality = 2; bool is_monotonic = 3; }
+//	NumberDataPoint { fixed64 start_time_unix_nano = 2; fixed64 time_unix_nano = 3; double as_double = 4; repeated KeyValue attributes = 7; }
+//
+// We leave start_time_unix_nano unset, which means unknown: the counters we
+// read, like RAPL energy, usually start at boot, not when we started.
+func (s *Sink) encode(scrape sensor.Scrape, samples []sensor.Sample) []byte {
+	// Group samples per metric, keeping the order they came in.
+	var names []string
+	points := make(map[string][]byte)
+	for _, sample := range samples {
+		if _, exists := points[sample.Name]; !exists {
+			names = append(names, sample.Name)
+		}
+		point := protobuf.AppendFixed64(nil, 3, uint64(scrape.Time.UnixNano()))
+		point = protobuf.AppendDouble(point, 4, sample.Value)
+		for _, l := range sample.Labels {
+			if l.Name == "instance" { // It is a resource attribute
+				continue
+			}
+			point = protobuf.AppendBytes(point, 7, keyValue(l.Name, l.Value))
+		}
+		points[sample.Name] = protobuf.AppendBytes(points[sample.Name], 1, point)
+	}
+
+	var scope []byte
+	scope = protobuf.AppendBytes(scope, 1, protobuf.AppendString(nil, 1, "sensor_exporter"))
+	for _, name := range names {
+		var metric []byte
+		metric = protobuf.AppendString(metric, 1, name)
+		metric = protobuf.AppendString(metric, 2, sensor.MetricHelp(scrape.Sensor, name))
+		if sensor.MetricType(scrape.Sensor, name) == "counter" {
+			sum := points[name]
+			sum = protobuf.AppendUint64(sum, 2, aggregationTemporalityCumulative)
+			sum = protobuf.AppendBool(sum, 3, true)
+			metric = protobuf.AppendBytes(metric, 7, sum)
+		} else {
+			metric = protobuf.AppendBytes(metric, 5, points[name])
+		}
+		scope = protobuf.AppendBytes(scope, 2, metric)
+	}
+
+	var resource []byte
+	resource = protobuf.AppendBytes(resource, 1, keyValue("service.name", "sensor_exporter"))
+	resource = protobuf.AppendBytes(resource, 1, keyValue("host.name", s.Host))
+	resource = protobuf.AppendBytes(resource, 1, keyValue("sensor.type", scrape.Sensor))
+	resource = protobuf.AppendBytes(resource, 1, keyValue("sensor.instance", scrape.Instance))
+
+	var resourceMetrics []byte
+	resourceMetrics = protobuf.AppendBytes(resourceMetrics, 1, resource)
+	resourceMetrics = protobuf.AppendBytes(resourceMetrics, 2, scope)
+
+	return protobuf.AppendBytes(nil, 1, resourceMetrics)
+}
+
+// keyValue encodes a KeyValue with a string AnyValue:
+//
+//	KeyValue { string key = 1; AnyValue value = 2; }
+//	AnyValue { string string_value = 1; }
+//
+// string_value is a oneof member, so it is written even when empty.
+func keyValue(key, value string) []byte {
+	var kv []byte
+	kv = protobuf.AppendString(kv, 1, key)
+	return protobuf.AppendBytes(kv, 2, protobuf.AppendBytes(nil, 1, []byte(value)))
+}
+
+func init() {
+	sensor.RegisterSink("otlp", NewSink, description)
+}
@@ -0,0 +1,103 @@
+//
+// Copyright 2016 Marios Andreopoulos
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package sink_otlp
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/andmarios/sensor_exporter/sensor"
+)
+
+// golden is the ExportMetricsServiceRequest for scrape, encoded by hand from
+// the OTLP protos. Counters have no start_time_unix_nano.
+var golden = "" +
+	"0ac0020a740a210a0c736572766963652e6e616d6512110a0f73656e736f725f" +
+	"6578706f727465720a130a09686f73742e6e616d6512060a04776562310a190a" +
+	"0b73656e736f722e74797065120a0a086f746c70746573740a1f0a0f73656e73" +
+	"6f722e696e7374616e6365120c0a0a6f746c70746573742d3112c7010a110a0f" +
+	"73656e736f725f6578706f72746572127c0a18746573745f74656d7065726174" +
+	"7572655f63656c73697573120e412074656d70657261747572652e2a500a2619" +
+	"00007a082ece7b14210000000000c044403a120a0673656e736f7212080a0643" +
+	"6f726520300a261900007a082ece7b142100000000000045403a120a0673656e" +
+	"736f7212080a06436f7265203112340a18746573745f656e657267795f6a6f75" +
+	"6c65735f746f74616c3a180a121900007a082ece7b1421000000000048934010" +
+	"021801"
+
+var scrape = sensor.Scrape{
+	Sensor:   "otlptest",
+	Instance: "otlptest-1",
+	Time:     time.Unix(1476000000, 0),
+	Output: `test_temperature_celsius{sensor="Core 0",instance="otlptest-1"} 41.5
+test_temperature_celsius{sensor="Core 1",instance="otlptest-1"} 42
+test_energy_joules_total{instance="otlptest-1"} 1234
+`,
+}
+
+func init() {
+	sensor.AvailableCollectors["otlptest"] = sensor.CollectorEntry{
+		Type: []string{"# TYPE test_temperature_celsius gauge", "# TYPE test_energy_joules_total counter"},
+		Help: []string{"# HELP test_temperature_celsius A temperature."},
+	}
+}
+
+func TestWrite(t *testing.T) {
+	want, _ := hex.DecodeString(golden)
+	var got []byte
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ct := r.Header.Get("Content-Type"); ct != "application/x-protobuf" {
+			t.Errorf("Content-Type = %q", ct)
+		}
+		if auth := r.Header.Get("Authorization"); auth != "Bearer secret" {
+			t.Errorf("Authorization = %q", auth)
+		}
+		got, _ = ioutil.ReadAll(r.Body)
+	}))
+	defer ts.Close()
+
+	s, err := NewSink("url=" + ts.URL + ",host=web1,header.Authorization=Bearer secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Write(scrape); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("request =\n%x\nwant\n%x", got, want)
+	}
+}
+
+func TestWriteError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad data", http.StatusBadRequest)
+	}))
+	defer ts.Close()
+
+	s, err := NewSink("url=" + ts.URL + ",host=web1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Write(scrape); err == nil {
+		t.Error("Write did not fail when the collector rejected the request")
+	}
+}
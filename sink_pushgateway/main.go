@@ -0,0 +1,238 @@
+//
+// Copyright 2016 Marios Andreopoulos
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+/*
+Package sink_pushgateway periodically pushes the latest scrape of every
+sensor to a Prometheus Pushgateway. It is useful for hosts that can not be
+scraped, e.g behind NAT.
+
+Its opts are comma separated key=value pairs:
+
+	url       the Pushgateway url, like http://pushgateway:9091 (required)
+	job       the job grouping key (default sensor_exporter)
+	group.KEY an extra grouping key, like group.site=closet (may be repeated)
+	interval  how often to push (default 15s)
+	method    put replaces all metrics of the group, post only the pushed
+	          ones (default put)
+	user      user for basic auth
+	password  password for basic auth
+
+A scrape is pushed until it is older than the push interval, so the interval
+should not be shorter than the scrape interval of the sensors. A failed push
+is counted as an error of the sink and retried on the next cycle.
+*/
+package sink_pushgateway
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andmarios/sensor_exporter/sensor"
+)
+
+var description = `Pushgateway pushes the latest scrape of every sensor to a Prometheus Pushgateway
+periodically. Its opts are comma separated key=value pairs: url (required),
+job, group.KEY (extra grouping keys), interval, method (put or post), user and
+password (basic auth). Example:
+
+  sensor_exporter -sink pushgateway,,url=http://pg:9091,group.site=closet,interval=30s upsc,,MYUPS`
+
+var defaultInterval = 15 * time.Second
+var timeOut = 10 * time.Second
+
+type Sink struct {
+	Url      string
+	Method   string
+	User     string
+	Password string
+	Interval time.Duration
+	client   *http.Client
+	mutex    sync.Mutex
+	latest   map[string]sensor.Scrape
+	errors   sensor.SinkErrors
+}
+
+func NewSink(opts string) (sensor.Sink, error) {
+	options, err := sensor.ParseOptions(opts)
+	if err != nil {
+		return nil, errors.New("Pushgateway " + err.Error())
+	}
+	if options["url"] == "" {
+		return nil, errors.New("Pushgateway needs a url option.")
+	}
+	job := options["job"]
+	if job == "" {
+		job = "sensor_exporter"
+	}
+	s := &Sink{Method: http.MethodPut, User: options["user"], Password: options["password"],
+		Interval: defaultInterval, client: &http.Client{Timeout: timeOut},
+		latest: make(map[string]sensor.Scrape), errors: sensor.NewSinkErrors()}
+
+	switch strings.ToLower(options["method"]) {
+	case "", "put":
+	case "post":
+		s.Method = http.MethodPost
+	default:
+		return nil, errors.New("Pushgateway method should be put or post, not " + options["method"])
+	}
+	if options["interval"] != "" {
+		s.Interval, err = time.ParseDuration(options["interval"])
+		if err != nil || s.Interval <= 0 {
+			return nil, errors.New("Pushgateway could not understand interval: " + options["interval"])
+		}
+	}
+
+	// Grouping keys are sorted, so the url is the same every time.
+	var groups []string
+	for k := range options {
+		if strings.HasPrefix(k, "group.") {
+			groups = append(groups, k)
+		}
+	}
+	sort.Strings(groups)
+	s.Url = strings.TrimSuffix(options["url"], "/") + "/metrics/" + groupingKey("job", job)
+	for _, k := range groups {
+		s.Url += "/" + groupingKey(strings.TrimPrefix(k, "group."), options[k])
+	}
+
+	go s.pushLoop()
+	return s, nil
+}
+
+// groupingKey encodes a label pair as a url path. Values that can not be
+// part of a path are base64 encoded, as the Pushgateway expects.
+func groupingKey(name, value string) string {
+	if value == "" {
+		return name + "@base64/="
+	}
+	if strings.Contains(value, "/") {
+		return name + "@base64/" + base64.RawURLEncoding.EncodeToString([]byte(value))
+	}
+	return name + "/" + url.PathEscape(value)
+}
+
+// Write keeps the latest scrape of each sensor instance until the next push.
+func (s *Sink) Write(scrape sensor.Scrape) error {
+	s.mutex.Lock()
+	s.latest[scrape.Instance] = scrape
+	s.mutex.Unlock()
+	return nil
+}
+
+func (s *Sink) pushLoop() {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := s.push(); err != nil {
+			s.errors.Send(errors.New("Pushgateway could not push to " + s.Url + ": " + err.Error()))
+		}
+	}
+}
+
+// Errors returns the failures of the periodic pushes.
+func (s *Sink) Errors() <-chan error {
+	return s.errors
+}
+
+func (s *Sink) push() error {
+	body := s.body()
+	if body.Len() == 0 {
+		return nil
+	}
+	req, err := http.NewRequest(s.Method, s.Url, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+	if s.User != "" {
+		req.SetBasicAuth(s.User, s.Password)
+	}
+	res, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(res.Body, 512))
+		return fmt.Errorf("pushgateway returned %s: %s", res.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// body builds the text format payload of a push. Series of the same metric
+// must be grouped under a single TYPE line, so we can not just concatenate
+// the sensors' outputs.
+func (s *Sink) body() *bytes.Buffer {
+	families := make(map[string][]sensor.Sample)
+	types := make(map[string]string)
+	helps := make(map[string]string)
+
+	s.mutex.Lock()
+	for instance, scrape := range s.latest {
+		// A sensor that stopped scraping, like one whose device is gone,
+		// should not be pushed forever.
+		if time.Since(scrape.Time) > s.Interval {
+			delete(s.latest, instance)
+			continue
+		}
+		samples, err := scrape.Samples()
+		if err != nil {
+			log.Printf("Pushgateway could not parse output of %s. Err: %s\n", scrape.Instance, err)
+		}
+		for _, sample := range samples {
+			if _, exists := types[sample.Name]; !exists {
+				types[sample.Name] = sensor.MetricType(scrape.Sensor, sample.Name)
+				helps[sample.Name] = sensor.MetricHelp(scrape.Sensor, sample.Name)
+			}
+			families[sample.Name] = append(families[sample.Name], sample)
+		}
+	}
+	s.mutex.Unlock()
+
+	var names []string
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b bytes.Buffer
+	for _, name := range names {
+		if helps[name] != "" {
+			fmt.Fprintf(&b, "# HELP %s %s\n", name, helps[name])
+		}
+		fmt.Fprintf(&b, "# TYPE %s %s\n", name, types[name])
+		for _, sample := range families[name] {
+			fmt.Fprintln(&b, sample.String())
+		}
+	}
+	return &b
+}
+
+func init() {
+	sensor.RegisterSink("pushgateway", NewSink, description)
+}
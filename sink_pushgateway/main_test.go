@@ -0,0 +1,146 @@
+//
+// Copyright 2016 Marios Andreopoulos
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package sink_pushgateway
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andmarios/sensor_exporter/sensor"
+)
+
+func TestGroupingKey(t *testing.T) {
+	tests := []struct {
+		name, value string
+		want        string
+	}{
+		{"job", "sensor_exporter", "job/sensor_exporter"},
+		{"site", "", "site@base64/="},
+		{"site", "my closet", "site/my%20closet"},
+		{"path", "/var/tmp", "path@base64/L3Zhci90bXA"},
+	}
+	for _, tt := range tests {
+		if got := groupingKey(tt.name, tt.value); got != tt.want {
+			t.Errorf("groupingKey(%q, %q) = %q, want %q", tt.name, tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestUrl(t *testing.T) {
+	tests := []struct {
+		opts string
+		want string
+	}{
+		{"url=http://pg:9091", "http://pg:9091/metrics/job/sensor_exporter"},
+		{"url=http://pg:9091/,job=lab", "http://pg:9091/metrics/job/lab"},
+		// Grouping keys are sorted.
+		{"url=http://pg:9091,group.site=closet,group.rack=a/1",
+			"http://pg:9091/metrics/job/sensor_exporter/rack@base64/YS8x/site/closet"},
+	}
+	for _, tt := range tests {
+		s, err := NewSink(tt.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := s.(*Sink).Url; got != tt.want {
+			t.Errorf("%s: url = %q, want %q", tt.opts, got, tt.want)
+		}
+	}
+}
+
+func TestPush(t *testing.T) {
+	tests := []struct {
+		opts   string
+		method string
+		auth   bool
+	}{
+		{"", http.MethodPut, false},
+		{",method=post", http.MethodPost, false},
+		{",method=put,user=me,password=secret", http.MethodPut, true},
+	}
+	for _, tt := range tests {
+		var method, body string
+		var user, password string
+		var auth bool
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			method = r.Method
+			user, password, auth = r.BasicAuth()
+			b, _ := ioutil.ReadAll(r.Body)
+			body = string(b)
+		}))
+
+		s, err := NewSink("url=" + ts.URL + tt.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.Write(sensor.Scrape{Sensor: "example", Instance: "example-1", Time: time.Now(),
+			Output: "m{instance=\"example-1\"} 1\n"})
+		if err := s.(*Sink).push(); err != nil {
+			t.Error(err)
+		}
+		ts.Close()
+
+		if method != tt.method {
+			t.Errorf("%q: method = %s, want %s", tt.opts, method, tt.method)
+		}
+		if auth != tt.auth || (auth && (user != "me" || password != "secret")) {
+			t.Errorf("%q: basic auth = %v %q %q", tt.opts, auth, user, password)
+		}
+		if want := "# TYPE m untyped\nm{instance=\"example-1\"} 1\n"; body != want {
+			t.Errorf("%q: body = %q, want %q", tt.opts, body, want)
+		}
+	}
+}
+
+func TestPushError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad metrics", http.StatusBadRequest)
+	}))
+	defer ts.Close()
+
+	s, err := NewSink("url=" + ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Write(sensor.Scrape{Sensor: "example", Instance: "example-1", Time: time.Now(), Output: "m 1\n"})
+	if err := s.(*Sink).push(); err == nil || !strings.Contains(err.Error(), "bad metrics") {
+		t.Errorf("push() error = %v", err)
+	}
+}
+
+func TestBodyDropsOldScrapes(t *testing.T) {
+	s, err := NewSink("url=http://pg:9091,interval=1m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Write(sensor.Scrape{Sensor: "example", Instance: "example-1", Time: time.Now(),
+		Output: "m{instance=\"example-1\"} 1\n"})
+	s.Write(sensor.Scrape{Sensor: "example", Instance: "example-2", Time: time.Now().Add(-2 * time.Minute),
+		Output: "m{instance=\"example-2\"} 2\n"})
+
+	if got, want := s.(*Sink).body().String(), "# TYPE m untyped\nm{instance=\"example-1\"} 1\n"; got != want {
+		t.Errorf("body = %q, want %q", got, want)
+	}
+	if _, exists := s.(*Sink).latest["example-2"]; exists {
+		t.Error("old scrape was not removed")
+	}
+}
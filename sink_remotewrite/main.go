@@ -0,0 +1,279 @@
+//
+// Copyright 2016 Marios Andreopoulos
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+/*
+Package sink_remotewrite sends samples to a Prometheus remote write endpoint,
+using snappy compressed protobuf messages. It is meant for sites with flaky
+links: whilst the endpoint is unreachable, samples are kept in a size bounded
+queue on disk, and are sent in order once it comes back.
+
+Every series carries the sink's external labels, host=HOSTNAME by default, so
+that series from many hosts writing to the same endpoint don't collide.
+
+Its opts are comma separated key=value pairs:
+
+	url       the remote write endpoint (required)
+	dir       directory for the on-disk queue (required); it must not be
+	          shared with another remotewrite sink
+	external_labels
+	          labels added to every series, like host=web1;dc=eu1; series
+	          that already have a label keep it (default host=HOSTNAME)
+	max_size  maximum size of the queue in bytes; when exceeded the oldest
+	          samples are dropped (default 67108864)
+	batch     maximum number of scrapes sent in one request (default 50)
+	user      user for basic auth
+	password  password for basic auth
+	token     bearer token
+
+See <https://prometheus.io/docs/concepts/remote_write_spec/>.
+*/
+package sink_remotewrite
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/andmarios/sensor_exporter/internal/protobuf"
+	"github.com/andmarios/sensor_exporter/internal/snappy"
+	"github.com/andmarios/sensor_exporter/sensor"
+)
+
+var description = `Remotewrite sends samples to a Prometheus remote write endpoint. Whilst the
+endpoint is unreachable, samples are buffered in a size bounded queue and sent
+in order once it is back. Its opts are comma separated key=value pairs: url
+and dir (on-disk queue) are required; external_labels (default host=HOSTNAME),
+max_size (queue bytes), batch (scrapes per request), user and password (basic
+auth) or token (bearer) are optional. Example:
+
+  sensor_exporter -sink remotewrite,,url=http://prom:9090/api/v1/write,dir=/var/lib/sensor_exporter upsc,,MYUPS`
+
+var (
+	defaultMaxSize = int64(64 << 20)
+	defaultBatch   = 50
+	timeOut        = 30 * time.Second
+	minBackoff     = time.Second
+	maxBackoff     = time.Minute
+)
+
+type Sink struct {
+	Url            string
+	User           string
+	Password       string
+	Token          string
+	Batch          int
+	ExternalLabels []sensor.Label
+	client         *http.Client
+	queue          *queue
+	notify         chan struct{}
+	errors         sensor.SinkErrors
+}
+
+func NewSink(opts string) (sensor.Sink, error) {
+	options, err := sensor.ParseOptions(opts)
+	if err != nil {
+		return nil, errors.New("Remotewrite " + err.Error())
+	}
+	if options["url"] == "" {
+		return nil, errors.New("Remotewrite needs a url option.")
+	}
+	if options["dir"] == "" {
+		return nil, errors.New("Remotewrite needs a dir option for its on-disk queue.")
+	}
+	s := &Sink{Url: options["url"], User: options["user"], Password: options["password"],
+		Token: options["token"], Batch: defaultBatch, client: &http.Client{Timeout: timeOut},
+		notify: make(chan struct{}, 1), errors: sensor.NewSinkErrors()}
+
+	maxSize := defaultMaxSize
+	if options["max_size"] != "" {
+		maxSize, err = strconv.ParseInt(options["max_size"], 10, 64)
+		if err != nil || maxSize <= 0 {
+			return nil, errors.New("Remotewrite max_size should be a positive number of bytes.")
+		}
+	}
+	if options["batch"] != "" {
+		s.Batch, err = strconv.Atoi(options["batch"])
+		if err != nil || s.Batch <= 0 {
+			return nil, errors.New("Remotewrite batch should be a positive number.")
+		}
+	}
+
+	s.ExternalLabels, err = sensor.ExternalLabels(options, "external_labels")
+	if err != nil {
+		return nil, errors.New("Remotewrite " + err.Error())
+	}
+
+	s.queue, err = newQueue(options["dir"], maxSize)
+	if err != nil {
+		return nil, errors.New("Remotewrite could not open queue: " + err.Error())
+	}
+	if n := s.queue.len(); n > 0 {
+		log.Printf("Remotewrite found %d queued scrapes, will replay them.\n", n)
+	}
+
+	go s.sendLoop()
+	return s, nil
+}
+
+// Write encodes a scrape as a write request and queues it.
+func (s *Sink) Write(scrape sensor.Scrape) error {
+	samples, err := scrape.Samples()
+	if err != nil {
+		return err
+	}
+	if len(samples) == 0 {
+		return nil
+	}
+	dropped, err := s.queue.push(encodeWriteRequest(samples, s.ExternalLabels, scrape.Time))
+	if err != nil {
+		return err
+	}
+	if dropped > 0 {
+		s.errors.Send(fmt.Errorf("Remotewrite queue is full, dropped %d oldest scrapes", dropped))
+	}
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Errors returns the failures of sending the queue.
+func (s *Sink) Errors() <-chan error {
+	return s.errors
+}
+
+// sendLoop sends queued requests in order. On failure it backs off and tries
+// again with the same requests, so order is kept.
+func (s *Sink) sendLoop() {
+	backoff := minBackoff
+	for {
+		records, last, unreadable := s.queue.peek(s.Batch)
+		if unreadable > 0 {
+			s.errors.Send(fmt.Errorf("Remotewrite could not read %d queued scrapes, dropped them", unreadable))
+		}
+		if len(records) == 0 {
+			<-s.notify
+			continue
+		}
+
+		// Concatenated protobuf messages of the same type merge into one
+		// message, with their repeated fields appended.
+		err := s.send(bytes.Join(records, nil))
+		if err == nil {
+			s.queue.remove(last)
+			backoff = minBackoff
+			continue
+		}
+		if _, ok := err.(permanentError); ok {
+			s.errors.Send(fmt.Errorf("Remotewrite endpoint rejected %d scrapes, dropping them: %s", len(records), err))
+			s.queue.remove(last)
+			continue
+		}
+		s.errors.Send(fmt.Errorf("Remotewrite could not send to %s, retrying in %s: %s", s.Url, backoff, err))
+		time.Sleep(backoff)
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// A permanentError is returned for requests that should not be retried.
+type permanentError struct {
+	error
+}
+
+func (s *Sink) send(writeRequest []byte) error {
+	req, err := http.NewRequest(http.MethodPost, s.Url, bytes.NewReader(snappy.Encode(writeRequest)))
+	if err != nil {
+		return permanentError{err}
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("User-Agent", "sensor_exporter")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	if s.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.Token)
+	} else if s.User != "" {
+		req.SetBasicAuth(s.User, s.Password)
+	}
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 == 2 {
+		return nil
+	}
+	msg, _ := ioutil.ReadAll(io.LimitReader(res.Body, 512))
+	err = fmt.Errorf("endpoint returned %s: %s", res.Status, bytes.TrimSpace(msg))
+	// As the spec says, 5xx and 429 may be retried, other errors may not.
+	if res.StatusCode/100 == 5 || res.StatusCode == http.StatusTooManyRequests {
+		return err
+	}
+	return permanentError{err}
+}
+
+// encodeWriteRequest encodes samples as a prometheus.WriteRequest. External
+// labels are added to every series that does not have them already.
+//
+//	message WriteRequest { repeated TimeSeries timeseries = 1; }
+//	message TimeSeries { repeated Label labels = 1; repeated Sample samples = 2; }
+//	message Label { string name = 1; string value = 2; }
+//	message Sample { double value = 1; int64 timestamp = 2; }
+func encodeWriteRequest(samples []sensor.Sample, external []sensor.Label, t time.Time) []byte {
+	timestamp := t.UnixNano() / int64(time.Millisecond)
+	var request []byte
+	for _, sample := range samples {
+		// Labels must be sorted by name, __name__ included.
+		labels := append([]sensor.Label{{Name: "__name__", Value: sample.Name}}, sample.Labels...)
+		for _, l := range external {
+			if sample.Label(l.Name) == "" {
+				labels = append(labels, l)
+			}
+		}
+		sort.Slice(labels, func(i, j int) bool { return labels[i].Name < labels[j].Name })
+
+		var series []byte
+		for _, l := range labels {
+			var label []byte
+			label = protobuf.AppendString(label, 1, l.Name)
+			label = protobuf.AppendString(label, 2, l.Value)
+			series = protobuf.AppendBytes(series, 1, label)
+		}
+		var s []byte
+		s = protobuf.AppendDouble(s, 1, sample.Value)
+		s = protobuf.AppendInt64(s, 2, timestamp)
+		series = protobuf.AppendBytes(series, 2, s)
+
+		request = protobuf.AppendBytes(request, 1, series)
+	}
+	return request
+}
+
+func init() {
+	sensor.RegisterSink("remotewrite", NewSink, description)
+}
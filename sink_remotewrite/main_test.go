@@ -0,0 +1,233 @@
+//
+// Copyright 2016 Marios Andreopoulos
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package sink_remotewrite
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/andmarios/sensor_exporter/internal/protobuf"
+	"github.com/andmarios/sensor_exporter/sensor"
+)
+
+// label encodes a prometheus.Label as it appears in a TimeSeries.
+func label(name, value string) []byte {
+	var l []byte
+	l = protobuf.AppendString(l, 1, name)
+	l = protobuf.AppendString(l, 2, value)
+	return protobuf.AppendBytes(nil, 1, l)
+}
+
+func TestEncodeWriteRequestExternalLabels(t *testing.T) {
+	samples := []sensor.Sample{
+		{Name: "m", Labels: []sensor.Label{{Name: "instance", Value: "example-1"}}, Value: 1},
+		{Name: "m", Labels: []sensor.Label{{Name: "host", Value: "other"}}, Value: 2},
+	}
+	external := []sensor.Label{{Name: "host", Value: "web1"}, {Name: "dc", Value: "eu1"}}
+	request := encodeWriteRequest(samples, external, time.Unix(1600000000, 0))
+
+	// Labels are sorted by name: __name__, dc, host, instance.
+	var want []byte
+	want = append(want, label("__name__", "m")...)
+	want = append(want, label("dc", "eu1")...)
+	want = append(want, label("host", "web1")...)
+	want = append(want, label("instance", "example-1")...)
+	if !bytes.Contains(request, want) {
+		t.Error("first series does not carry the sorted external labels")
+	}
+
+	// A series that has the label already keeps its own value.
+	want = append(label("__name__", "m"), label("dc", "eu1")...)
+	want = append(want, label("host", "other")...)
+	if !bytes.Contains(request, want) {
+		t.Error("second series did not keep its own host label")
+	}
+	if bytes.Count(request, label("host", "web1")) != 1 {
+		t.Error("external host label was added to a series that had one")
+	}
+}
+
+func TestNewSinkNeedsDir(t *testing.T) {
+	if _, err := NewSink("url=http://localhost:9090/api/v1/write"); err == nil {
+		t.Error("NewSink did not fail without a dir")
+	}
+}
+
+func TestQueue(t *testing.T) {
+	dir, err := ioutil.TempDir("", "remotewrite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	q, err := newQueue(dir, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range []string{"aaaa", "bbbb", "cccc"} {
+		q.push([]byte(r))
+	}
+	records, last, _ := q.peek(10)
+	if len(records) != 2 || string(records[0]) != "bbbb" {
+		t.Fatalf("queue kept %q, want the two newest records", records)
+	}
+
+	// A new queue on the same directory picks up the records.
+	q, err = newQueue(dir, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.len() != 2 {
+		t.Errorf("reopened queue has %d records, want 2", q.len())
+	}
+	q.remove(last)
+	if q.len() != 0 {
+		t.Errorf("queue has %d records after remove, want 0", q.len())
+	}
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 0 {
+		t.Errorf("queue left %d files behind", len(files))
+	}
+}
+
+func init() {
+	minBackoff = 20 * time.Millisecond
+	maxBackoff = 40 * time.Millisecond
+}
+
+// endpoint answers remote write requests with the given status codes in turn,
+// then with 204, and records when each request arrived.
+type endpoint struct {
+	sync.Mutex
+	codes    []int
+	requests []time.Time
+	bodies   [][]byte
+	header   http.Header
+}
+
+func (e *endpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	e.Lock()
+	defer e.Unlock()
+	e.requests = append(e.requests, time.Now())
+	e.bodies = append(e.bodies, body)
+	e.header = r.Header
+	code := http.StatusNoContent
+	if len(e.codes) > 0 {
+		code, e.codes = e.codes[0], e.codes[1:]
+	}
+	w.WriteHeader(code)
+}
+
+// waitFor waits until the endpoint got n requests and the sink's queue is
+// empty.
+func waitFor(t *testing.T, e *endpoint, s *Sink, n int) {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		e.Lock()
+		got := len(e.requests)
+		e.Unlock()
+		if got >= n && s.queue.len() == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("endpoint got %d requests, want %d; %d scrapes queued", got, n, s.queue.len())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func newTestSink(t *testing.T, url string) *Sink {
+	s, err := NewSink("url=" + url + ",dir=" + t.TempDir() + ",token=secret,external_labels=")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s.(*Sink)
+}
+
+var scrape = sensor.Scrape{Sensor: "example", Instance: "example-1", Time: time.Unix(1600000000, 0),
+	Output: "m{instance=\"example-1\"} 1\n"}
+
+func TestSendRetries(t *testing.T) {
+	e := &endpoint{codes: []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusInternalServerError}}
+	ts := httptest.NewServer(e)
+	defer ts.Close()
+	s := newTestSink(t, ts.URL)
+
+	if err := s.Write(scrape); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, e, s, 4)
+
+	e.Lock()
+	defer e.Unlock()
+	if len(e.requests) != 4 {
+		t.Fatalf("endpoint got %d requests, want 4", len(e.requests))
+	}
+	// The same request is retried, backing off 20ms, 40ms and 40ms (the max).
+	for i, min := range []time.Duration{20, 40, 40} {
+		if gap := e.requests[i+1].Sub(e.requests[i]); gap < min*time.Millisecond {
+			t.Errorf("retry %d came after %s, want at least %dms", i+1, gap, min)
+		}
+		if !bytes.Equal(e.bodies[i+1], e.bodies[0]) {
+			t.Errorf("retry %d sent a different request", i+1)
+		}
+	}
+	if len(s.errors) != 3 {
+		t.Errorf("sink reported %d errors, want 3", len(s.errors))
+	}
+	for _, h := range []struct{ name, want string }{
+		{"Content-Encoding", "snappy"},
+		{"Content-Type", "application/x-protobuf"},
+		{"X-Prometheus-Remote-Write-Version", "0.1.0"},
+		{"Authorization", "Bearer secret"},
+	} {
+		if got := e.header.Get(h.name); got != h.want {
+			t.Errorf("header %s = %q, want %q", h.name, got, h.want)
+		}
+	}
+}
+
+func TestSendDropsRejected(t *testing.T) {
+	e := &endpoint{codes: []int{http.StatusBadRequest}}
+	ts := httptest.NewServer(e)
+	defer ts.Close()
+	s := newTestSink(t, ts.URL)
+
+	if err := s.Write(scrape); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, e, s, 1)
+	// Give the sink the time to retry, if it would.
+	time.Sleep(3 * minBackoff)
+
+	e.Lock()
+	defer e.Unlock()
+	if len(e.requests) != 1 {
+		t.Errorf("endpoint got %d requests, want a single one", len(e.requests))
+	}
+	if len(s.errors) != 1 {
+		t.Errorf("sink reported %d errors, want 1", len(s.errors))
+	}
+}
@@ -0,0 +1,166 @@
+//
+// Copyright 2016 Marios Andreopoulos
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package sink_remotewrite
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// A queue keeps encoded write requests in order until they are sent. Records
+// are kept in files in its directory, one per record, so they survive
+// restarts. When the queue grows beyond maxSize bytes, the oldest records are
+// dropped.
+type queue struct {
+	dir     string
+	maxSize int64
+
+	mutex   sync.Mutex
+	records []record
+	size    int64
+	nextSeq uint64
+}
+
+type record struct {
+	seq  uint64
+	size int64
+}
+
+const recordSuffix = ".pb"
+
+func newQueue(dir string, maxSize int64) (*queue, error) {
+	q := &queue{dir: dir, maxSize: maxSize, nextSeq: 1}
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, err
+	}
+
+	// Pick up records left from a previous run.
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), recordSuffix) {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(f.Name(), recordSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		q.records = append(q.records, record{seq: seq, size: f.Size()})
+		q.size += f.Size()
+	}
+	sort.Slice(q.records, func(i, j int) bool { return q.records[i].seq < q.records[j].seq })
+	if len(q.records) > 0 {
+		q.nextSeq = q.records[len(q.records)-1].seq + 1
+	}
+	return q, nil
+}
+
+func (q *queue) filename(seq uint64) string {
+	return filepath.Join(q.dir, fmt.Sprintf("%020d%s", seq, recordSuffix))
+}
+
+// push adds a record to the end of the queue. It returns the number of
+// records that were dropped to make room for it.
+func (q *queue) push(data []byte) (int, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	r := record{seq: q.nextSeq, size: int64(len(data))}
+	if r.size > q.maxSize {
+		return 0, errors.New("record is larger than the queue")
+	}
+	if err := ioutil.WriteFile(q.filename(r.seq), data, 0640); err != nil {
+		return 0, err
+	}
+	q.nextSeq++
+	q.records = append(q.records, r)
+	q.size += r.size
+
+	dropped := 0
+	for q.size > q.maxSize {
+		q.removeLocked(1)
+		dropped++
+	}
+	return dropped, nil
+}
+
+// peek returns the data of up to n records from the start of the queue,
+// without removing them, and the sequence number of the last one. Records that
+// can not be read will never be sent, so they are dropped; their number is
+// returned too.
+func (q *queue) peek(n int) ([][]byte, uint64, int) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	var out [][]byte
+	var last uint64
+	unreadable := 0
+	for i := 0; i < len(q.records) && len(out) < n; {
+		r := q.records[i]
+		data, err := ioutil.ReadFile(q.filename(r.seq))
+		if err != nil {
+			os.Remove(q.filename(r.seq))
+			q.size -= r.size
+			q.records = append(q.records[:i], q.records[i+1:]...)
+			unreadable++
+			continue
+		}
+		out = append(out, data)
+		last = r.seq
+		i++
+	}
+	return out, last, unreadable
+}
+
+// remove drops the records up to and including sequence number last. Records
+// may have already been dropped by push whilst they were being sent.
+func (q *queue) remove(last uint64) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	n := 0
+	for n < len(q.records) && q.records[n].seq <= last {
+		n++
+	}
+	q.removeLocked(n)
+}
+
+func (q *queue) removeLocked(n int) {
+	if n > len(q.records) {
+		n = len(q.records)
+	}
+	for _, r := range q.records[:n] {
+		os.Remove(q.filename(r.seq))
+		q.size -= r.size
+	}
+	q.records = q.records[n:]
+}
+
+func (q *queue) len() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return len(q.records)
+}
@@ -0,0 +1,189 @@
+//
+// Copyright 2016 Marios Andreopoulos
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+/*
+Package sink_statsd emits every reading as a StatsD gauge over UDP, so hosts
+that already run a statsd agent can forward sensor data.
+
+With the DogStatsD tag extension, labels are sent as tags:
+
+	cpu_temperature_celsius:41|g|#instance:coretemp-1,sensor:Core_0
+
+Without it, label values are appended to the metric name, sorted by label
+name, like the graphite sink does:
+
+	cpu_temperature_celsius.coretemp-1.Core_0:41|g
+
+Its opts are comma separated key=value pairs:
+
+	address    the statsd agent (default localhost:8125)
+	prefix     prefix for every metric name (default sensor_exporter)
+	tags       labels added to every series, like host=web1;dc=eu1; series
+	           that already have a label keep it (default host=HOSTNAME)
+	dogstatsd  send labels as DogStatsD tags, true or false (default false)
+
+Set prefix or tags to nothing (prefix=) to leave them out.
+*/
+package sink_statsd
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/andmarios/sensor_exporter/sensor"
+)
+
+var description = `Statsd emits every reading as a StatsD gauge over UDP. With dogstatsd=true
+labels are sent as DogStatsD tags, else they are appended to the metric name.
+Its opts are comma separated key=value pairs: address (default
+localhost:8125), prefix (default sensor_exporter), tags (default
+host=HOSTNAME) and dogstatsd. Example:
+
+  sensor_exporter -sink statsd,,address=localhost:8125,dogstatsd=true coretemp hddtemp`
+
+var (
+	defaultAddress = "localhost:8125"
+	defaultPrefix  = "sensor_exporter"
+	// Keep packets below a common MTU, as statsd agents expect.
+	maxPacket   = 1432
+	unsafeChars = regexp.MustCompile(`[^a-zA-Z0-9_\-.]`)
+	unsafeTags  = regexp.MustCompile(`[,|#\s]`)
+)
+
+type Sink struct {
+	Address   string
+	Prefix    string
+	Tags      []sensor.Label
+	DogStatsd bool
+	conn      net.Conn
+}
+
+func NewSink(opts string) (sensor.Sink, error) {
+	options, err := sensor.ParseOptions(opts)
+	if err != nil {
+		return nil, errors.New("Statsd " + err.Error())
+	}
+	s := &Sink{Address: options["address"], Prefix: defaultPrefix}
+	if s.Address == "" {
+		s.Address = defaultAddress
+	}
+	if prefix, set := options["prefix"]; set {
+		s.Prefix = prefix
+	}
+	s.Tags, err = sensor.ExternalLabels(options, "tags")
+	if err != nil {
+		return nil, errors.New("Statsd " + err.Error())
+	}
+	if options["dogstatsd"] != "" {
+		s.DogStatsd, err = strconv.ParseBool(options["dogstatsd"])
+		if err != nil {
+			return nil, errors.New("Statsd dogstatsd should be true or false, not " + options["dogstatsd"])
+		}
+	}
+	// UDP does not really connect, so this only fails on bad addresses.
+	s.conn, err = net.Dial("udp", s.Address)
+	if err != nil {
+		return nil, errors.New("Statsd could not resolve " + s.Address + ": " + err.Error())
+	}
+	return s, nil
+}
+
+func (s *Sink) Write(scrape sensor.Scrape) error {
+	samples, err := scrape.Samples()
+	if err != nil {
+		return err
+	}
+
+	var packet bytes.Buffer
+	for _, sample := range samples {
+		if math.IsNaN(sample.Value) || math.IsInf(sample.Value, 0) {
+			continue
+		}
+		// The lines of a sample go in the same packet, so a reset is never
+		// separated from its value.
+		lines := strings.Join(s.lines(sample), "\n")
+		if packet.Len() > 0 && packet.Len()+len(lines)+1 > maxPacket {
+			if _, err := s.conn.Write(packet.Bytes()); err != nil {
+				return err
+			}
+			packet.Reset()
+		}
+		if packet.Len() > 0 {
+			packet.WriteByte('\n')
+		}
+		packet.WriteString(lines)
+	}
+	if packet.Len() == 0 {
+		return nil
+	}
+	_, err = s.conn.Write(packet.Bytes())
+	return err
+}
+
+// lines formats a sample as statsd gauge lines. In plain statsd a signed
+// gauge value is a change to the gauge, so negative values must be sent as
+// a reset to zero followed by the value.
+func (s *Sink) lines(sample sensor.Sample) []string {
+	// Tags are added unless the series has them already.
+	labels := append([]sensor.Label(nil), sample.Labels...)
+	for _, l := range s.Tags {
+		if sample.Label(l.Name) == "" {
+			labels = append(labels, l)
+		}
+	}
+	sort.Slice(labels, func(i, j int) bool { return labels[i].Name < labels[j].Name })
+
+	name := sample.Name
+	if s.Prefix != "" {
+		name = s.Prefix + "." + name
+	}
+	value := strconv.FormatFloat(sample.Value, 'f', -1, 64)
+
+	if s.DogStatsd {
+		var tags []string
+		for _, l := range labels {
+			tags = append(tags, unsafeTags.ReplaceAllString(l.Name, "_")+":"+unsafeTags.ReplaceAllString(l.Value, "_"))
+		}
+		line := name + ":" + value + "|g"
+		if len(tags) > 0 {
+			line += "|#" + strings.Join(tags, ",")
+		}
+		return []string{line}
+	}
+
+	for _, l := range labels {
+		v := l.Value
+		if v == "" {
+			v = "unknown"
+		}
+		name += "." + unsafeChars.ReplaceAllString(strings.Replace(v, ".", "_", -1), "_")
+	}
+	if sample.Value < 0 {
+		return []string{name + ":0|g", name + ":" + value + "|g"}
+	}
+	return []string{name + ":" + value + "|g"}
+}
+
+func init() {
+	sensor.RegisterSink("statsd", NewSink, description)
+}
@@ -0,0 +1,111 @@
+//
+// Copyright 2016 Marios Andreopoulos
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package sink_statsd
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andmarios/sensor_exporter/sensor"
+)
+
+func TestLines(t *testing.T) {
+	hostname, _ := os.Hostname()
+	host := unsafeChars.ReplaceAllString(strings.Replace(hostname, ".", "_", -1), "_")
+	sample := sensor.Sample{Name: "cpu_temperature_celsius",
+		Labels: []sensor.Label{{Name: "sensor", Value: "Core 0"}, {Name: "instance", Value: "coretemp-1"}}, Value: 41}
+	negative := sensor.Sample{Name: "ups_current_amperes",
+		Labels: []sensor.Label{{Name: "instance", Value: "upsc-1"}, {Name: "ups", Value: "my.ups"}}, Value: -1.5}
+	tests := []struct {
+		opts   string
+		sample sensor.Sample
+		want   []string
+	}{
+		{"", sample, []string{"sensor_exporter.cpu_temperature_celsius." + host + ".coretemp-1.Core_0:41|g"}},
+		{"prefix=,tags=", sample, []string{"cpu_temperature_celsius.coretemp-1.Core_0:41|g"}},
+		{"prefix=sensors,tags=host=web1;dc=eu1", sample,
+			[]string{"sensors.cpu_temperature_celsius.eu1.web1.coretemp-1.Core_0:41|g"}},
+		{"dogstatsd=true,tags=host=web1", sample,
+			[]string{"sensor_exporter.cpu_temperature_celsius:41|g|#host:web1,instance:coretemp-1,sensor:Core_0"}},
+		{"tags=instance=other", sample, []string{"sensor_exporter.cpu_temperature_celsius.coretemp-1.Core_0:41|g"}},
+		// A negative gauge is reset first, except with DogStatsD.
+		{"tags=", negative, []string{"sensor_exporter.ups_current_amperes.upsc-1.my_ups:0|g",
+			"sensor_exporter.ups_current_amperes.upsc-1.my_ups:-1.5|g"}},
+		{"tags=,dogstatsd=true", negative,
+			[]string{"sensor_exporter.ups_current_amperes:-1.5|g|#instance:upsc-1,ups:my.ups"}},
+	}
+	for _, tt := range tests {
+		s, err := NewSink(tt.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := s.(*Sink).lines(tt.sample); strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+			t.Errorf("%q: lines = %q, want %q", tt.opts, got, tt.want)
+		}
+	}
+}
+
+func TestWritePackets(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	s, err := NewSink("address=" + conn.LocalAddr().String() + ",prefix=,tags=")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Negative values take two lines; enough of them for a few packets.
+	var output strings.Builder
+	for i := 0; i < 200; i++ {
+		fmt.Fprintf(&output, "temperature_celsius{sensor=\"outdoor_%d\"} -%d\n", i, i+1)
+	}
+	if err := s.Write(sensor.Scrape{Output: output.String()}); err != nil {
+		t.Fatal(err)
+	}
+
+	lines, packets := 0, 0
+	b := make([]byte, 65536)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for lines < 400 {
+		n, _, err := conn.ReadFrom(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		packets++
+		if n > maxPacket {
+			t.Errorf("packet of %d bytes is larger than %d", n, maxPacket)
+		}
+		packet := strings.Split(string(b[:n]), "\n")
+		for i, line := range packet {
+			if strings.HasSuffix(line, ":0|g") && (i+1 == len(packet) ||
+				!strings.HasPrefix(packet[i+1], strings.TrimSuffix(line, "0|g")+"-")) {
+				t.Errorf("reset %q is not followed by its value in the same packet", line)
+			}
+		}
+		lines += len(packet)
+	}
+	if lines != 400 || packets < 2 {
+		t.Errorf("got %d lines in %d packets, want 400 in a few", lines, packets)
+	}
+}
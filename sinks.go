@@ -0,0 +1,159 @@
+//
+// Copyright 2016 Marios Andreopoulos
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/andmarios/sensor_exporter/sensor"
+)
+
+var defaultSinkBuffer = 100
+
+// sinkFlags holds the sinks set on the command line. It implements flag.Value
+// so it can be set multiple times.
+type sinkFlags []string
+
+func (s *sinkFlags) String() string {
+	return strings.Join(*s, " ")
+}
+
+func (s *sinkFlags) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// A SinkRunner feeds a sink with scrapes from its own buffered queue, so a
+// slow or failing sink can not hold back the sensors or the other sinks.
+type SinkRunner struct {
+	Name    string
+	Sink    sensor.Sink
+	queue   chan sensor.Scrape
+	writes  uint64
+	errors  uint64
+	dropped uint64
+}
+
+var sinks []*SinkRunner
+
+// processSinkArg creates a sink from a sink_name,buffer,opts string. Buffer is
+// the number of scrapes that may wait for the sink before we start dropping
+// them.
+func processSinkArg(arg string) (*SinkRunner, error) {
+	conf := strings.SplitN(arg, ",", 3)
+	var opts string
+	buffer := defaultSinkBuffer
+
+	switch len(conf) {
+	case 3:
+		opts = conf[2]
+		fallthrough
+	case 2:
+		if conf[1] != "" {
+			n, err := strconv.Atoi(conf[1])
+			if err != nil || n < 1 {
+				return nil, errors.New("Sink buffer should be a positive number, not " + conf[1])
+			}
+			buffer = n
+		}
+		fallthrough
+	case 1:
+		if _, exists := sensor.AvailableSinks[conf[0]]; !exists {
+			return nil, errors.New("Sink " + conf[0] + " not found")
+		}
+	default:
+		return nil, errors.New("Could not create sink")
+	}
+
+	log.Printf("Adding sink %s with buffer %d and opts: %s\n", conf[0], buffer, opts)
+	sink, err := sensor.AvailableSinks[conf[0]].New(opts)
+	if err != nil {
+		return nil, errors.New("Could not init sink: " + err.Error())
+	}
+	name := fmt.Sprintf("%s-%d", conf[0], len(sinks)+1)
+	return &SinkRunner{Name: name, Sink: sink, queue: make(chan sensor.Scrape, buffer)}, nil
+}
+
+// startSink writes the scrapes that arrive at a sink's queue to the sink. If
+// the sink also fails in goroutines of its own, these failures are counted
+// as its errors too.
+func startSink(r *SinkRunner) {
+	go func() {
+		for scrape := range r.queue {
+			if err := r.Sink.Write(scrape); err != nil {
+				atomic.AddUint64(&r.errors, 1)
+				sensor.LabelledIncident(r.Name, "sink_error")
+				log.Printf("Sink %s could not write scrape of %s. Err: %s\n", r.Name, scrape.Instance, err)
+				continue
+			}
+			atomic.AddUint64(&r.writes, 1)
+		}
+	}()
+	if async, ok := r.Sink.(sensor.AsyncSink); ok {
+		go func() {
+			for err := range async.Errors() {
+				atomic.AddUint64(&r.errors, 1)
+				sensor.LabelledIncident(r.Name, "sink_error")
+				log.Printf("Sink %s failed. Err: %s\n", r.Name, err)
+			}
+		}()
+	}
+}
+
+// dispatch fans out a scrape to every sink. It never blocks; if a sink's
+// queue is full, the scrape is dropped for that sink. The incident we raise
+// then carries the sink's name, since the sink is what falls behind.
+func dispatch(scrape sensor.Scrape) {
+	for _, r := range sinks {
+		select {
+		case r.queue <- scrape:
+		default:
+			if atomic.AddUint64(&r.dropped, 1) == 1 {
+				log.Printf("Sink %s is falling behind, dropping scrapes.\n", r.Name)
+			}
+			sensor.LabelledIncident(r.Name, "sink_dropped")
+		}
+	}
+}
+
+// writeSinkMetrics writes statistics about our sinks in Prometheus format.
+func writeSinkMetrics(w io.Writer) {
+	if len(sinks) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "# TYPE sensor_exporter_sink_writes_total counter")
+	fmt.Fprintln(w, "# HELP sensor_exporter_sink_writes_total Scrapes successfully written to each sink.")
+	fmt.Fprintln(w, "# TYPE sensor_exporter_sink_errors_total counter")
+	fmt.Fprintln(w, "# HELP sensor_exporter_sink_errors_total Failed writes of each sink, including those it makes in the background.")
+	fmt.Fprintln(w, "# TYPE sensor_exporter_sink_dropped_total counter")
+	fmt.Fprintln(w, "# HELP sensor_exporter_sink_dropped_total Scrapes dropped because a sink's buffer was full.")
+	fmt.Fprintln(w, "# TYPE sensor_exporter_sink_queue_length gauge")
+	fmt.Fprintln(w, "# HELP sensor_exporter_sink_queue_length Scrapes waiting in each sink's buffer.")
+	for _, r := range sinks {
+		fmt.Fprintf(w, "sensor_exporter_sink_writes_total{sink=\"%s\"} %d\n", r.Name, atomic.LoadUint64(&r.writes))
+		fmt.Fprintf(w, "sensor_exporter_sink_errors_total{sink=\"%s\"} %d\n", r.Name, atomic.LoadUint64(&r.errors))
+		fmt.Fprintf(w, "sensor_exporter_sink_dropped_total{sink=\"%s\"} %d\n", r.Name, atomic.LoadUint64(&r.dropped))
+		fmt.Fprintf(w, "sensor_exporter_sink_queue_length{sink=\"%s\"} %d\n", r.Name, len(r.queue))
+	}
+}
@@ -0,0 +1,70 @@
+//
+// Copyright 2016 Marios Andreopoulos
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/andmarios/sensor_exporter/sensor"
+)
+
+// failingSink fails every other write, and once in the background.
+type failingSink struct {
+	n      int
+	errors sensor.SinkErrors
+}
+
+func (s *failingSink) Write(scrape sensor.Scrape) error {
+	s.n++
+	if s.n%2 == 0 {
+		return errors.New("write failed")
+	}
+	return nil
+}
+
+func (s *failingSink) Errors() <-chan error {
+	return s.errors
+}
+
+func TestStartSink(t *testing.T) {
+	sink := &failingSink{errors: sensor.NewSinkErrors()}
+	r := &SinkRunner{Name: "failing-1", Sink: sink, queue: make(chan sensor.Scrape, 4)}
+	before := sensor.GetLabelledIncidents()[sensor.IncidentLabel{Sensor: "failing-1", Reason: "sink_error"}]
+
+	startSink(r)
+	for i := 0; i < 4; i++ {
+		r.queue <- sensor.Scrape{Sensor: "example", Instance: "example-1"}
+	}
+	sink.errors.Send(errors.New("push failed"))
+
+	// Two failed writes and one failure in the background.
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadUint64(&r.writes) != 2 || atomic.LoadUint64(&r.errors) != 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("writes = %d, errors = %d, want 2 and 3", atomic.LoadUint64(&r.writes), atomic.LoadUint64(&r.errors))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	close(r.queue)
+	if got := sensor.GetLabelledIncidents()[sensor.IncidentLabel{Sensor: "failing-1", Reason: "sink_error"}] - before; got != 3 {
+		t.Errorf("sink_error incidents = %d, want 3", got)
+	}
+}